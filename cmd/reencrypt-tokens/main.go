@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"supreme-broccoli/internal/config"
+	"supreme-broccoli/internal/database"
+	"supreme-broccoli/internal/secrets"
+)
+
+// reencrypt-tokens encrypts OAuth tokens stored in plaintext and moves tokens
+// sealed with older keys onto the current primary key. Run it once after
+// enabling token encryption and again after each key rotation, before the old
+// key is removed from TOKEN_ENCRYPTION_KEYS.
+func main() {
+	log.Println("=== Re-encrypting stored OAuth tokens ===")
+
+	// Takes the same config file, environment and flags as the server
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	keyring, err := secrets.ParseKeyring(cfg.TokenEncryptionKeys, cfg.TokenEncryptionKeyID)
+	if err != nil {
+		log.Fatalf("Invalid token encryption keys: %v", err)
+	}
+	log.Printf("Primary key: %s", keyring.PrimaryKeyID())
+
+	db, err := database.Connect(cfg.MongoDBURI, keyring)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	updated, skipped, failed, err := db.ReencryptUserTokens()
+	if err != nil {
+		log.Fatalf("Re-encryption aborted: %v", err)
+	}
+
+	log.Printf("✓ Re-encryption complete: %d updated, %d changed concurrently, %d failed", updated, skipped, failed)
+	if failed > 0 {
+		log.Fatal("Some users could not be re-encrypted; keep their old keys configured and investigate before retrying")
+	}
+}
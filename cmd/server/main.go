@@ -1,27 +1,80 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
 
+	"golang.org/x/crypto/acme/autocert"
+
+	"supreme-broccoli/internal/audit"
 	"supreme-broccoli/internal/auth"
+	"supreme-broccoli/internal/certs"
 	"supreme-broccoli/internal/config"
 	"supreme-broccoli/internal/database"
 	"supreme-broccoli/internal/handlers"
 	"supreme-broccoli/internal/middleware"
+	"supreme-broccoli/internal/models"
+	"supreme-broccoli/internal/recording"
+	"supreme-broccoli/internal/secrets"
+	"supreme-broccoli/internal/terminal"
+)
+
+// Connection timeouts for the public listeners. The main server sets no
+// read or write timeout on whole requests, since terminal WebSockets, file
+// transfers and proxied editor streams stay open for as long as they are in
+// use; it only bounds how long a client may take to send headers and how
+// long an idle keep-alive connection is held.
+const (
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
+	redirectTimeout   = 10 * time.Second
 )
 
 func main() {
-	// Load configuration
-	cfg := config.Load()
+	// Load configuration from the config file, environment and flags
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if cfg != nil && cfg.PrintConfig {
+		// Print even an invalid configuration, then report what is wrong
+		if printErr := cfg.Print(os.Stdout); printErr != nil {
+			log.Fatal(printErr)
+		}
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Load token encryption keys
+	keyring, err := secrets.ParseKeyring(cfg.TokenEncryptionKeys, cfg.TokenEncryptionKeyID)
+	if err != nil {
+		log.Fatalf("Invalid token encryption keys: %v", err)
+	}
 
 	// Initialize database
-	db, err := database.Connect(cfg.MongoDBURI)
+	db, err := database.Connect(cfg.MongoDBURI, keyring)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 
+	// Seed the course catalog on first run
+	if err := db.SeedCourses(models.DefaultCourses()); err != nil {
+		log.Printf("Warning: Failed to seed courses: %v", err)
+	}
+
 	// Initialize OAuth configuration
 	oauthConfig := auth.NewOAuthConfig(
 		cfg.GoogleClientID,
@@ -30,7 +83,7 @@ func main() {
 	)
 
 	// Initialize session store
-	sessionStore := auth.NewSessionStore(cfg.SessionKey)
+	sessionStore := auth.NewSessionStore(db, cfg.SessionKey, cfg.HTTPS())
 
 	// Initialize handlers
 	authHandlers := &handlers.AuthHandlers{
@@ -39,17 +92,56 @@ func main() {
 		DB:           db,
 	}
 
-	terminalHandlers := &handlers.TerminalHandlers{
-		OAuthConfig:  oauthConfig,
-		SessionStore: sessionStore,
-		DB:           db,
+	// Track running terminal sessions; detached ones are kept for reattaching
+	terminalSessions := terminal.NewManager(terminal.DefaultDetachGrace, terminal.DefaultScrollback, terminal.Limits{
+		MaxPerUser:  cfg.TerminalMaxSessionsPerUser,
+		MaxTotal:    cfg.TerminalMaxSessions,
+		IdleTimeout: cfg.TerminalIdleTimeout,
+		MaxDuration: cfg.TerminalMaxDuration,
+		WarnBefore:  terminal.DefaultWarnBefore,
+	})
+
+	terminalBackends, err := newTerminalBackends(cfg)
+	if err != nil {
+		log.Fatalf("Invalid terminal configuration: %v", err)
+	}
+
+	editorPorts, err := terminal.NewPortPool(cfg.EditorPortMin, cfg.EditorPortMax)
+	if err != nil {
+		log.Fatalf("Invalid editor port configuration: %v", err)
+	}
+
+	recordings, err := recording.NewStore(cfg.RecordingsDir, cfg.TerminalRecording)
+	if err != nil {
+		log.Fatalf("Invalid recording configuration: %v", err)
+	}
+
+	commandAudit, err := audit.NewPolicy(cfg.TerminalCommandAudit, cfg.TerminalCommandRetention, cfg.TerminalAuditRedactFile)
+	if err != nil {
+		log.Fatalf("Invalid command audit configuration: %v", err)
 	}
 
-	pageHandlers := handlers.NewPageHandlers(sessionStore)
+	// Only our own pages may open terminal WebSockets
+	checkOrigin, err := auth.NewOriginCheck(cfg.AppBaseURL, cfg.TerminalAllowedOrigins)
+	if err != nil {
+		log.Fatalf("Invalid terminal origin configuration: %v", err)
+	}
+	terminalTickets := auth.NewTicketStore(auth.DefaultTicketTTL)
+
+	terminalHandlers := handlers.NewTerminalHandlers(oauthConfig, sessionStore, db, terminalSessions, terminalBackends, editorPorts, recordings, commandAudit, int64(cfg.TerminalTransferMaxMB)<<20, terminalTickets, checkOrigin)
+	recordingHandlers := handlers.NewRecordingHandlers(sessionStore, db, recordings)
+	editorHandlers := handlers.NewEditorHandlers(sessionStore, db, terminalSessions, cfg.PreviewPorts)
+
+	// Cache user records so role checks don't hit MongoDB on every request
+	userCache := middleware.NewUserCache(db, middleware.DefaultUserCacheTTL)
+
+	pageHandlers := handlers.NewPageHandlers(sessionStore, db, userCache)
+
+	adminHandlers := handlers.NewAdminHandlers(sessionStore, db, userCache, terminalSessions, terminalBackends, recordings, commandAudit)
 
 	// Initialize middleware
-	authMiddleware := middleware.Auth(sessionStore)
-	adminMiddleware := middleware.Admin(sessionStore)
+	authMiddleware := middleware.Auth(sessionStore, userCache)
+	adminMiddleware := middleware.Admin(sessionStore, userCache)
 
 	// Register routes
 	// Public routes
@@ -68,6 +160,10 @@ func main() {
 
 	// Protected routes
 	http.Handle("/courses", authMiddleware(http.HandlerFunc(pageHandlers.HandleCourses)))
+	http.Handle("/courses/{id}/enroll", authMiddleware(http.HandlerFunc(pageHandlers.HandleEnroll)))
+	http.Handle("/courses/{id}/unenroll", authMiddleware(http.HandlerFunc(pageHandlers.HandleUnenroll)))
+	http.Handle("/courses/{id}/modules/{module}/complete", authMiddleware(http.HandlerFunc(pageHandlers.HandleCompleteModule)))
+	http.Handle("/terminal/course-detail/{id}/content", authMiddleware(http.HandlerFunc(pageHandlers.HandleCourseDetail)))
 	http.Handle("/profile", authMiddleware(http.HandlerFunc(pageHandlers.HandleProfile)))
 	http.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
 		authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -79,23 +175,153 @@ func main() {
 		})).ServeHTTP(w, r)
 	})
 	http.HandleFunc("/logout", authHandlers.HandleLogout)
+	http.Handle("/logout/all", authMiddleware(http.HandlerFunc(authHandlers.HandleLogoutAll)))
 	http.Handle("/terminal/", authMiddleware(http.HandlerFunc(terminalHandlers.HandleTerminal)))
+	http.Handle("/terminal/ticket", authMiddleware(http.HandlerFunc(terminalHandlers.HandleTicket)))
+	http.Handle("/terminal/sessions/{id}/share", authMiddleware(http.HandlerFunc(terminalHandlers.HandleShare)))
+	http.Handle("/terminal/sessions/{id}/unshare", authMiddleware(http.HandlerFunc(terminalHandlers.HandleUnshare)))
+	http.Handle("/terminal/sessions/{id}/upload", authMiddleware(http.HandlerFunc(terminalHandlers.HandleUpload)))
+	http.Handle("/terminal/sessions/{id}/download", authMiddleware(http.HandlerFunc(terminalHandlers.HandleDownload)))
 	http.HandleFunc("/ws", terminalHandlers.HandleWebSocket)
+	http.Handle("/recordings/{id}", authMiddleware(http.HandlerFunc(recordingHandlers.HandleRecording)))
+	http.Handle("/recordings/{id}/cast", authMiddleware(http.HandlerFunc(recordingHandlers.HandleRecordingCast)))
 
 	// Admin routes
-	http.Handle("/admin", adminMiddleware(http.HandlerFunc(handlers.HandleAdmin)))
+	http.Handle("/admin", adminMiddleware(http.HandlerFunc(adminHandlers.HandleAdmin)))
+	http.Handle("/admin/users", adminMiddleware(http.HandlerFunc(adminHandlers.HandleUsers)))
+	http.Handle("/admin/users/{email}/role", adminMiddleware(http.HandlerFunc(adminHandlers.HandleUserRole)))
+	http.Handle("/admin/users/{email}/sessions/revoke", adminMiddleware(http.HandlerFunc(adminHandlers.HandleRevokeSessions)))
+	http.Handle("/admin/sessions", adminMiddleware(http.HandlerFunc(adminHandlers.HandleSessions)))
+	http.Handle("/admin/recordings", adminMiddleware(http.HandlerFunc(adminHandlers.HandleRecordings)))
+	http.Handle("/admin/recordings/{id}/download", adminMiddleware(http.HandlerFunc(recordingHandlers.HandleDownloadRecording)))
+	http.Handle("/admin/commands", adminMiddleware(http.HandlerFunc(adminHandlers.HandleCommands)))
+	http.Handle("/admin/courses", adminMiddleware(http.HandlerFunc(adminHandlers.HandleCourses)))
+	http.Handle("/admin/courses/new", adminMiddleware(http.HandlerFunc(adminHandlers.HandleNewCourse)))
+	http.Handle("/admin/courses/{id}", adminMiddleware(http.HandlerFunc(adminHandlers.HandleCourse)))
+	http.Handle("/admin/courses/{id}/delete", adminMiddleware(http.HandlerFunc(adminHandlers.HandleDeleteCourse)))
+	http.Handle("/admin/messages", adminMiddleware(http.HandlerFunc(adminHandlers.HandleMessages)))
+	http.Handle("/admin/messages/{id}/status", adminMiddleware(http.HandlerFunc(adminHandlers.HandleMessageStatus)))
 
-	// Editor proxy route
-	proxyHandler := http.StripPrefix("/editor/", http.HandlerFunc(handlers.HandleEditorProxy))
+	// Editor proxy route; each user reaches the editor of their own session
+	proxyHandler := http.StripPrefix("/editor/", http.HandlerFunc(editorHandlers.HandleEditorProxy))
 	http.Handle("/editor/", authMiddleware(proxyHandler))
+	http.Handle("/preview/{port}/{path...}", authMiddleware(http.HandlerFunc(editorHandlers.HandlePreviewProxy)))
 
 	// Static file serving
 	fs := http.FileServer(http.Dir("static"))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
 
+	// Browsers that have seen the site over HTTPS keep using it
+	handler := http.Handler(http.DefaultServeMux)
+	if cfg.HTTPS() && cfg.HSTSMaxAge > 0 {
+		handler = middleware.HSTS(cfg.HSTSMaxAge)(handler)
+	}
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.ServerPort),
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
 	// Start server
-	log.Printf("Starting web terminal server on http://localhost:%s", cfg.ServerPort)
-	if err := http.ListenAndServe(":"+cfg.ServerPort, nil); err != nil {
-		log.Fatal("ListenAndServe:", err)
+	if !cfg.TLSEnabled() {
+		log.Printf("Starting web terminal server on http://localhost:%d", cfg.ServerPort)
+		if err := server.ListenAndServe(); err != nil {
+			log.Fatal("ListenAndServe:", err)
+		}
+		return
+	}
+
+	tlsConfig, redirect, err := newTLSConfig(cfg)
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
 	}
+	server.TLSConfig = tlsConfig
+
+	if cfg.HTTPRedirectPort != 0 {
+		redirectServer := &http.Server{
+			Addr:              ":" + strconv.Itoa(cfg.HTTPRedirectPort),
+			Handler:           redirect,
+			ReadHeaderTimeout: readHeaderTimeout,
+			ReadTimeout:       redirectTimeout,
+			WriteTimeout:      redirectTimeout,
+			IdleTimeout:       idleTimeout,
+		}
+		go func() {
+			log.Printf("Redirecting http://localhost:%d to HTTPS", cfg.HTTPRedirectPort)
+			if err := redirectServer.ListenAndServe(); err != nil {
+				log.Fatal("ListenAndServe (redirect):", err)
+			}
+		}()
+	}
+
+	// HTTP/2 is negotiated automatically over TLS
+	log.Printf("Starting web terminal server on https://localhost:%d", cfg.ServerPort)
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		log.Fatal("ListenAndServeTLS:", err)
+	}
+}
+
+// newTLSConfig builds the TLS configuration for the certificate files or
+// Let's Encrypt domains in cfg, along with the handler for the plain HTTP
+// redirect listener
+func newTLSConfig(cfg *config.Config) (*tls.Config, http.Handler, error) {
+	baseURL, err := url.Parse(cfg.AppBaseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	redirect := middleware.RedirectToHTTPS(baseURL.Host)
+
+	if len(cfg.TLSAutocertDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cfg.TLSAutocertCacheDir),
+			HostPolicy: autocert.HostWhitelist(cfg.TLSAutocertDomains...),
+			Email:      cfg.TLSAutocertEmail,
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		// The redirect listener also answers HTTP-01 challenges
+		return tlsConfig, manager.HTTPHandler(redirect), nil
+	}
+
+	reloader, err := certs.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile, certs.DefaultReloadInterval)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}, redirect, nil
+}
+
+// newTerminalBackends builds the terminal backends enabled by the configuration
+func newTerminalBackends(cfg *config.Config) (*terminal.Backends, error) {
+	backends := []terminal.Backend{
+		&terminal.CloudShellBackend{EditorPort: 8080, PreviewPorts: cfg.PreviewPorts},
+	}
+
+	// The local backend gives users a shell on this server, so it must be
+	// enabled explicitly
+	if cfg.TerminalShell != "" || cfg.TerminalBackend == terminal.BackendLocal {
+		backends = append(backends, &terminal.LocalShellBackend{Shell: cfg.TerminalShell})
+	}
+	if cfg.DockerImage != "" {
+		backends = append(backends, &terminal.DockerBackend{
+			Image:  cfg.DockerImage,
+			Memory: cfg.DockerMemory,
+			CPUs:   cfg.DockerCPUs,
+		})
+	}
+	if cfg.SSHHost != "" {
+		backends = append(backends, &terminal.SSHBackend{
+			Host:           cfg.SSHHost,
+			Port:           cfg.SSHPort,
+			User:           cfg.SSHUser,
+			IdentityFile:   cfg.SSHIdentityFile,
+			KnownHostsFile: cfg.SSHKnownHostsFile,
+		})
+	}
+
+	return terminal.NewBackends(cfg.TerminalBackend, backends...)
 }
@@ -0,0 +1,42 @@
+// Package audit turns terminal session traffic into command records for the
+// compliance audit log.
+package audit
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policy configures the command audit log. A nil *Policy means commands are
+// not audited.
+type Policy struct {
+	// Redactor replaces secrets in commands before they are stored
+	Redactor *Redactor
+	// Retention is how long command records are kept
+	Retention time.Duration
+}
+
+// NewPolicy builds the audit policy from configuration. It returns nil when
+// auditing is disabled. patternsFile, if set, adds redaction patterns to the
+// defaults; see ReadPatterns.
+func NewPolicy(enabled bool, retention time.Duration, patternsFile string) (*Policy, error) {
+	if !enabled {
+		return nil, nil
+	}
+	if retention <= 0 {
+		return nil, fmt.Errorf("command retention must be positive, got %s", retention)
+	}
+
+	var patterns []string
+	if patternsFile != "" {
+		var err error
+		if patterns, err = ReadPatterns(patternsFile); err != nil {
+			return nil, err
+		}
+	}
+	redactor, err := NewRedactor(patterns)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{Redactor: redactor, Retention: retention}, nil
+}
@@ -0,0 +1,424 @@
+package audit
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Command sources: how a command was captured
+const (
+	// SourceInput commands were rebuilt from the keys the user typed. Lines
+	// recalled from history or edited with cursor movement may be incomplete.
+	SourceInput = "input"
+	// SourceShell commands were marked by the shell itself with OSC 133
+	// escape sequences, which also report exit codes
+	SourceShell = "shell"
+)
+
+// Limits on what the tap buffers per session
+const (
+	maxLineLength  = 4096
+	maxEchoWindow  = 16 * 1024
+	maxOSCLength   = 512
+	echoWait       = 5 * time.Second // how long a typed line may wait to be echoed
+	recordsPending = 64
+)
+
+// Command is one command run in a terminal session, already redacted
+type Command struct {
+	Text       string
+	ExitCode   *int
+	Source     string
+	ExecutedAt time.Time
+}
+
+// Tap watches a terminal session and reports each command run in it. It
+// implements terminal.Tap.
+//
+// Commands are rebuilt from input: printable keys, backspace, ^U, ^W and ^C
+// are applied and Enter ends a line. A line is only recorded once the
+// terminal has echoed it back, so input typed at a password prompt is never
+// stored. When the shell emits OSC 133 shell-integration markers, the
+// command line echoed between the prompt-end (B) and command-start (C)
+// markers is recorded too, with the exit code from the command-finished (D)
+// marker. The markers arrive in output the user controls, so they only ever
+// add to what input capture records: a typed line is replaced by a marked
+// one only when the two match, and is recorded on its own otherwise.
+type Tap struct {
+	redactor *Redactor
+	records  chan Command
+	done     chan struct{}
+
+	mu       sync.Mutex
+	in, out  escapeScanner
+	shell    bool     // OSC 133 markers have been seen
+	held     *Command // shell mode: echoed input line awaiting marker C
+	typed    []byte
+	lineFrom int64       // output position when the typed line was started
+	unechoed []typedLine // entered lines waiting for their echo
+	echo     []byte      // recent output text, for matching echoes
+	echoBase int64       // output position of echo[0]
+	marked   []byte      // shell mode: command line echoed since marker B
+	marking  bool        // shell mode: between markers B and C
+	executed *Command    // shell mode: started, awaiting marker D
+	closed   bool
+}
+
+// typedLine is a line entered in input mode that has not been echoed yet
+type typedLine struct {
+	text    string
+	from    int64 // output position the echo must follow
+	entered time.Time
+}
+
+// NewTap creates a tap that redacts each command with redactor and passes
+// it to record. record is called from a separate goroutine, in order, and
+// may block without holding up the session.
+func NewTap(redactor *Redactor, record func(Command)) *Tap {
+	t := &Tap{
+		redactor: redactor,
+		records:  make(chan Command, recordsPending),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		for cmd := range t.records {
+			record(cmd)
+		}
+	}()
+	return t
+}
+
+// Input implements terminal.Tap
+func (t *Tap) Input(data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expireUnechoed(time.Now())
+	t.in.scan(data, t.inputByte, nil)
+}
+
+// Output implements terminal.Tap
+func (t *Tap) Output(data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.out.scan(data, t.outputByte, t.marker)
+	t.confirmEchoed()
+}
+
+// Resize implements terminal.Tap
+func (t *Tap) Resize(cols, rows uint16) {}
+
+// Close implements terminal.Tap. A command still waiting for its exit code
+// is recorded without one; lines never echoed are dropped.
+func (t *Tap) Close() error {
+	t.mu.Lock()
+	t.releaseHeld()
+	if t.executed != nil {
+		t.emit(*t.executed)
+		t.executed = nil
+	}
+	t.unechoed = nil
+	t.closed = true
+	close(t.records)
+	t.mu.Unlock()
+
+	<-t.done
+	return nil
+}
+
+// inputByte applies one typed byte to the line being typed. t.mu must be held.
+func (t *Tap) inputByte(b byte) {
+	switch b {
+	case '\r', '\n':
+		if text := strings.TrimSpace(string(t.typed)); text != "" {
+			t.unechoed = append(t.unechoed, typedLine{text: text, from: t.lineFrom, entered: time.Now()})
+		}
+		t.typed = t.typed[:0]
+	case 0x7f, '\b':
+		t.typed = backspace(t.typed)
+	case 0x03, 0x15: // ^C, ^U
+		t.typed = t.typed[:0]
+	case 0x17: // ^W
+		t.typed = deleteWord(t.typed)
+	default:
+		if b < 0x20 {
+			// Tab completion and other editing keys change the line in ways
+			// only the shell knows
+			return
+		}
+		if len(t.typed) == 0 {
+			t.lineFrom = t.echoBase + int64(len(t.echo))
+		}
+		if len(t.typed) < maxLineLength {
+			t.typed = append(t.typed, b)
+		}
+	}
+}
+
+// outputByte applies one byte of output text to the echo window, and to
+// the marked command line in shell mode. t.mu must be held.
+func (t *Tap) outputByte(b byte) {
+	if t.marking {
+		switch {
+		case b == '\b':
+			t.marked = backspace(t.marked)
+		case b >= 0x20 && b != 0x7f && len(t.marked) < maxLineLength:
+			t.marked = append(t.marked, b)
+		}
+	}
+
+	switch {
+	case b == '\b':
+		t.echo = backspace(t.echo)
+	case b == '\n' || (b >= 0x20 && b != 0x7f):
+		t.echo = append(t.echo, b)
+	}
+	if over := len(t.echo) - maxEchoWindow; over > 0 {
+		t.echo = append(t.echo[:0], t.echo[over:]...)
+		t.echoBase += int64(over)
+	}
+}
+
+// confirmEchoed records typed lines the terminal has echoed back. In shell
+// mode the latest line is held until marker C shows whether the shell
+// reports it too. Lines whose echo does not match are dropped. t.mu must be
+// held.
+func (t *Tap) confirmEchoed() {
+	for len(t.unechoed) > 0 {
+		line := t.unechoed[0]
+		echoed, pending := t.echoed(line)
+		if pending {
+			return
+		}
+		if !echoed {
+			t.unechoed = t.unechoed[1:]
+			continue
+		}
+		cmd := Command{Text: line.text, Source: SourceInput, ExecutedAt: line.entered}
+		t.unechoed = t.unechoed[1:]
+		if t.shell {
+			t.releaseHeld()
+			t.held = &cmd
+		} else {
+			t.emit(cmd)
+		}
+	}
+}
+
+// echoed reports whether the output starting where line was typed is its
+// echo. Only leading spaces, and line breaks once the echo has begun, may
+// come between its characters, so the same text turning up later in output
+// does not count. pending means the output so far is a partial echo.
+func (t *Tap) echoed(line typedLine) (echoed, pending bool) {
+	start := line.from - t.echoBase
+	if start < 0 || start > int64(len(t.echo)) {
+		return false, false
+	}
+
+	text := []byte(line.text)
+	matched := 0
+	for _, b := range t.echo[start:] {
+		switch {
+		case b == text[matched]:
+			matched++
+			if matched == len(text) {
+				return true, false
+			}
+		case b == ' ' && matched == 0:
+		case b == '\n' && matched > 0:
+		default:
+			return false, false
+		}
+	}
+	return false, true
+}
+
+// expireUnechoed drops typed lines the terminal never echoed, such as
+// passwords, and records a held line the shell never marked. t.mu must be
+// held.
+func (t *Tap) expireUnechoed(now time.Time) {
+	for len(t.unechoed) > 0 && now.Sub(t.unechoed[0].entered) > echoWait {
+		t.unechoed = t.unechoed[1:]
+	}
+	if t.held != nil && now.Sub(t.held.ExecutedAt) > echoWait {
+		t.releaseHeld()
+	}
+}
+
+// marker handles an OSC sequence from the output. t.mu must be held.
+func (t *Tap) marker(osc string) {
+	params, ok := strings.CutPrefix(osc, "133;")
+	if !ok || params == "" {
+		return
+	}
+	// A typed line's echo usually arrives in the same write as the marker,
+	// so match it first
+	t.confirmEchoed()
+	t.shell = true
+
+	fields := strings.Split(params, ";")
+	switch fields[0] {
+	case "A": // prompt start; the previous command, if any, is over
+		t.releaseHeld()
+		t.finishExecuted(nil)
+		t.marking = false
+	case "B": // prompt end; the command line follows
+		t.releaseHeld()
+		t.finishExecuted(nil)
+		t.marking = true
+		t.marked = t.marked[:0]
+	case "C": // command start
+		if t.marking {
+			if text := strings.TrimSpace(string(t.marked)); text != "" {
+				if t.held != nil && t.held.Text == text {
+					// The shell reports the typed line itself, with its exit code
+					t.held = nil
+				}
+				t.executed = &Command{Text: text, Source: SourceShell, ExecutedAt: time.Now()}
+			}
+			t.marking = false
+		}
+		t.releaseHeld()
+	case "D": // command finished, with its exit code if known
+		var code *int
+		if len(fields) > 1 {
+			if n, err := strconv.Atoi(fields[1]); err == nil {
+				code = &n
+			}
+		}
+		t.finishExecuted(code)
+	}
+}
+
+// releaseHeld records the held input line, if any. t.mu must be held.
+func (t *Tap) releaseHeld() {
+	if t.held == nil {
+		return
+	}
+	cmd := *t.held
+	t.held = nil
+	t.emit(cmd)
+}
+
+// finishExecuted records the command awaiting its exit code. t.mu must be held.
+func (t *Tap) finishExecuted(code *int) {
+	if t.executed == nil {
+		return
+	}
+	cmd := *t.executed
+	cmd.ExitCode = code
+	t.executed = nil
+	t.emit(cmd)
+}
+
+// emit redacts a command and queues it for recording. If the recorder has
+// fallen far behind, the command is dropped rather than stalling the
+// session. t.mu must be held.
+func (t *Tap) emit(cmd Command) {
+	if t.closed {
+		return
+	}
+	cmd.Text = t.redactor.Redact(cmd.Text)
+	select {
+	case t.records <- cmd:
+	default:
+	}
+}
+
+// backspace removes the last character from a line
+func backspace(line []byte) []byte {
+	if len(line) == 0 {
+		return line
+	}
+	_, size := utf8.DecodeLastRune(line)
+	return line[:len(line)-size]
+}
+
+// deleteWord removes the last word, and the spaces after it, from a line
+func deleteWord(line []byte) []byte {
+	line = bytes.TrimRight(line, " ")
+	if i := bytes.LastIndexByte(line, ' '); i >= 0 {
+		return line[:i+1]
+	}
+	return line[:0]
+}
+
+// Escape sequence scanner states
+const (
+	scanText = iota
+	scanEscape
+	scanCSI
+	scanSS3
+	scanOSC
+	scanOSCEscape
+)
+
+// escapeScanner splits a terminal byte stream into text and escape
+// sequences, across writes. Text bytes are passed on; OSC sequences are
+// reported whole; other sequences are skipped.
+type escapeScanner struct {
+	state int
+	osc   []byte
+}
+
+// scan feeds data through the scanner. osc may be nil.
+func (s *escapeScanner) scan(data []byte, text func(byte), osc func(string)) {
+	for _, b := range data {
+		switch s.state {
+		case scanText:
+			if b == 0x1b {
+				s.state = scanEscape
+			} else {
+				text(b)
+			}
+		case scanEscape:
+			switch b {
+			case '[':
+				s.state = scanCSI
+			case 'O':
+				s.state = scanSS3
+			case ']':
+				s.state = scanOSC
+				s.osc = s.osc[:0]
+			default:
+				s.state = scanText
+			}
+		case scanCSI:
+			if b >= 0x40 && b <= 0x7e {
+				s.state = scanText
+			}
+		case scanSS3:
+			s.state = scanText
+		case scanOSC:
+			switch {
+			case b == 0x07:
+				s.endOSC(osc)
+			case b == 0x1b:
+				s.state = scanOSCEscape
+			case len(s.osc) < maxOSCLength:
+				s.osc = append(s.osc, b)
+			}
+		case scanOSCEscape:
+			// ESC \ terminates the sequence; anything else aborts it
+			if b == '\\' {
+				s.endOSC(osc)
+			} else {
+				s.state = scanText
+			}
+		}
+	}
+}
+
+// endOSC reports a completed OSC sequence
+func (s *escapeScanner) endOSC(osc func(string)) {
+	s.state = scanText
+	if osc != nil {
+		osc(string(s.osc))
+	}
+}
@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"sync"
+	"testing"
+)
+
+// collect runs fn against a new tap and returns the commands it recorded
+func collect(t *testing.T, fn func(tap *Tap)) []Command {
+	t.Helper()
+	redactor, err := NewRedactor(nil)
+	if err != nil {
+		t.Fatalf("NewRedactor failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var commands []Command
+	tap := NewTap(redactor, func(cmd Command) {
+		mu.Lock()
+		commands = append(commands, cmd)
+		mu.Unlock()
+	})
+	fn(tap)
+	tap.Close()
+	return commands
+}
+
+func TestTapInputLines(t *testing.T) {
+	commands := collect(t, func(tap *Tap) {
+		tap.Output([]byte("$ "))
+		// Typed with a typo fixed by backspace, and an arrow key ignored
+		for _, key := range [][2]string{{"l", "l"}, {"x", "x"}, {"\x7f", "\b \b"}, {"s", "s"}, {"\x1b[C", ""}, {" -l", " -l"}} {
+			tap.Input([]byte(key[0]))
+			tap.Output([]byte(key[1]))
+		}
+		tap.Input([]byte("\r"))
+		tap.Output([]byte("\r\ntotal 0\r\n$ "))
+
+		// A pasted command echoed after the whole line arrives
+		tap.Input([]byte("export TOKEN=abc\r"))
+		tap.Output([]byte("export TOKEN=abc\r\n$ "))
+
+		// ^C abandons a line
+		tap.Input([]byte("rm -rf /tmp/x\x03"))
+	})
+
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 commands, got %+v", commands)
+	}
+	if commands[0].Text != "ls -l" || commands[0].Source != SourceInput {
+		t.Errorf("Expected \"ls -l\" from input, got %+v", commands[0])
+	}
+	if commands[1].Text != "export TOKEN=[REDACTED]" {
+		t.Errorf("Expected the token to be redacted, got %q", commands[1].Text)
+	}
+}
+
+func TestTapSkipsUnechoedInput(t *testing.T) {
+	commands := collect(t, func(tap *Tap) {
+		tap.Output([]byte("[sudo] password for student: "))
+		tap.Input([]byte("hunter2\r"))
+		tap.Output([]byte("\r\n"))
+	})
+	if len(commands) != 0 {
+		t.Errorf("Expected input that was not echoed to be dropped, got %+v", commands)
+	}
+}
+
+func TestTapIgnoresLaterMatchingOutput(t *testing.T) {
+	commands := collect(t, func(tap *Tap) {
+		tap.Output([]byte("Password: "))
+		tap.Input([]byte("hunter2\r"))
+		tap.Output([]byte("\r\n"))
+		// The password shows up in later output, right after the prompt
+		// and again when the user prints a file
+		tap.Output([]byte("hunter2\r\n$ "))
+		tap.Input([]byte("cat notes\r"))
+		tap.Output([]byte("cat notes\r\nwifi password: hunter2\r\n$ "))
+	})
+	if len(commands) != 1 || commands[0].Text != "cat notes" {
+		t.Errorf("Expected only \"cat notes\", got %+v", commands)
+	}
+}
+
+func TestTapShellIntegration(t *testing.T) {
+	commands := collect(t, func(tap *Tap) {
+		// A typed line the shell also marks is recorded once, from the shell
+		tap.Output([]byte("\x1b]133;A\x07$ \x1b]133;B\x07"))
+		tap.Input([]byte("false\r"))
+		tap.Output([]byte("false\r\n\x1b]133;C\x07"))
+		tap.Output([]byte("\x1b]133;D;1\x1b\\\x1b]133;A\x07$ \x1b]133;B\x07"))
+
+		// Split across writes, and still running when the session ends
+		tap.Output([]byte("sleep 1"))
+		tap.Output([]byte("00\r\n\x1b]13"))
+		tap.Output([]byte("3;C\x07"))
+	})
+
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 commands, got %+v", commands)
+	}
+	if commands[0].Text != "false" || commands[0].Source != SourceShell || commands[0].ExitCode == nil || *commands[0].ExitCode != 1 {
+		t.Errorf("Expected \"false\" with exit code 1, got %+v", commands[0])
+	}
+	if commands[1].Text != "sleep 100" || commands[1].ExitCode != nil {
+		t.Errorf("Expected \"sleep 100\" without an exit code, got %+v", commands[1])
+	}
+}
+
+func TestTapForgedMarkersKeepInputCapture(t *testing.T) {
+	commands := collect(t, func(tap *Tap) {
+		// The user prints a marker themselves and never emits another
+		tap.Output([]byte("\x1b]133;A\x07$ "))
+		tap.Input([]byte("cat /etc/shadow\r"))
+		tap.Output([]byte("cat /etc/shadow\r\n$ "))
+		tap.Input([]byte("rm -rf /tmp/x\r"))
+		tap.Output([]byte("rm -rf /tmp/x\r\n$ "))
+
+		// A forged command line that differs from what was typed
+		tap.Input([]byte("whoami\r"))
+		tap.Output([]byte("whoami\r\n\x1b]133;B\x07ls\x1b]133;C\x07"))
+	})
+
+	want := []struct{ text, source string }{
+		{"cat /etc/shadow", SourceInput},
+		{"rm -rf /tmp/x", SourceInput},
+		{"whoami", SourceInput},
+		{"ls", SourceShell},
+	}
+	if len(commands) != len(want) {
+		t.Fatalf("Expected %d commands, got %+v", len(want), commands)
+	}
+	for i, w := range want {
+		if commands[i].Text != w.text || commands[i].Source != w.source {
+			t.Errorf("Command %d: expected %q from %s, got %+v", i, w.text, w.source, commands[i])
+		}
+	}
+}
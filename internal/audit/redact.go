@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in stored commands
+const Redacted = "[REDACTED]"
+
+// DefaultRedactPatterns catch common ways secrets end up on a command line.
+// Only the part matched by a group named "secret" is replaced; patterns
+// without one have their whole match replaced.
+var DefaultRedactPatterns = []string{
+	// password=..., --token ..., API_KEY: ...
+	`(?i)(?:pass(?:word|wd)?|secret|token|api[_-]?key|access[_-]?key)\s*[=:]\s*(?P<secret>"[^"]*"|'[^']*'|\S+)`,
+	`(?i)--(?:pass(?:word|wd)?|secret|token|api[_-]?key)\s+(?P<secret>"[^"]*"|'[^']*'|\S+)`,
+	// Authorization headers
+	`(?i)authorization:\s*(?:bearer|basic|token)\s+(?P<secret>[A-Za-z0-9._~+/=-]+)`,
+	// Credentials in URLs
+	`://[^/\s:@]+:(?P<secret>[^@\s/]+)@`,
+	// Well-known token formats: AWS access keys, GitHub and Google tokens
+	`\bAKIA[0-9A-Z]{16}\b`,
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+	`\bya29\.[A-Za-z0-9_-]+`,
+}
+
+// Redactor replaces secrets in commands before they are stored
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor compiles the default patterns plus any extra ones
+func NewRedactor(extra []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, pattern := range append(append([]string{}, DefaultRedactPatterns...), extra...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// ReadPatterns reads redaction patterns from a file, one regular expression
+// per line. Blank lines and lines starting with # are ignored.
+func ReadPatterns(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open redaction patterns: %v", err)
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read redaction patterns: %v", err)
+	}
+	return patterns, nil
+}
+
+// Redact returns s with every secret replaced by Redacted
+func (r *Redactor) Redact(s string) string {
+	for _, re := range r.patterns {
+		group := re.SubexpIndex("secret")
+		s = replaceMatches(re, s, group)
+	}
+	return s
+}
+
+// replaceMatches replaces group of every match of re in s, or the whole
+// match when group is negative
+func replaceMatches(re *regexp.Regexp, s string, group int) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if group > 0 && m[2*group] >= 0 {
+			start, end = m[2*group], m[2*group+1]
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(Redacted)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
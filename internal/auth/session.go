@@ -1,11 +1,20 @@
 package auth
 
 import (
+	"encoding/base32"
 	"encoding/gob"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
 
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"golang.org/x/oauth2"
 
+	"supreme-broccoli/internal/database"
 	"supreme-broccoli/internal/models"
 )
 
@@ -15,14 +24,170 @@ func init() {
 	gob.Register(models.User{})
 }
 
-// NewSessionStore creates a new cookie-based session store
-func NewSessionStore(key string) *sessions.CookieStore {
-	store := sessions.NewCookieStore([]byte(key))
-	store.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   86400 * 7, // 7 days
-		HttpOnly: true,
-		// Secure: true, // Enable in production with HTTPS
+// AnonymousSessionTTL caps the lifetime of a session nobody has signed in
+// to, which only holds flash messages or a login attempt in progress. It
+// matches the time a login attempt has to come back from Google.
+const AnonymousSessionTTL = 10 * time.Minute
+
+// SessionBackend persists server-side session records. *database.MongoDB
+// satisfies it.
+type SessionBackend interface {
+	SaveSession(record models.SessionRecord) error
+	GetSession(id string) (models.SessionRecord, error)
+	DeleteSession(id string) error
+}
+
+// ServerStore is a sessions.Store that keeps session values in a
+// SessionBackend. The cookie only carries a signed random session ID, so a
+// session can be revoked by deleting its record.
+type ServerStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options // default configuration
+	backend SessionBackend
+}
+
+// NewSessionStore creates a server-side session store that saves sessions to
+// backend, signing session IDs and data with key. secure marks the cookie
+// for HTTPS only and should be set whenever the site is served over HTTPS.
+func NewSessionStore(backend SessionBackend, key string, secure bool) *ServerStore {
+	codecs := securecookie.CodecsFromPairs([]byte(key))
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			// Session data is stored server-side, so the cookie size limit does not apply
+			sc.MaxLength(0)
+		}
 	}
+
+	store := &ServerStore{
+		Codecs: codecs,
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   86400 * 7, // 7 days
+			HttpOnly: true,
+			Secure:   secure,
+			// Lax still sends the cookie on the top-level redirect back from
+			// Google's sign-in, which Strict would not
+			SameSite: http.SameSiteLaxMode,
+		},
+		backend: backend,
+	}
+	store.MaxAge(store.Options.MaxAge)
 	return store
 }
+
+// Get returns a session for the given name after adding it to the registry
+func (s *ServerStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+// A cookie whose record was revoked or has expired yields a fresh session.
+func (s *ServerStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, errCookie := r.Cookie(name)
+	if errCookie != nil {
+		return session, nil
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(name, c.Value, &id, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	record, err := s.backend.GetSession(id)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return session, nil
+		}
+		return session, err
+	}
+
+	if err := securecookie.DecodeMulti(name, record.Data, &session.Values, s.Codecs...); err != nil {
+		return session, err
+	}
+	session.ID = id
+	session.IsNew = false
+	return session, nil
+}
+
+// Save persists the session and writes its ID cookie. A session with a
+// non-positive MaxAge is deleted from the backend and its cookie cleared.
+// A new session with no values is not stored, so anonymous requests
+// never create backend records, and a session without a signed-in user
+// expires after AnonymousSessionTTL.
+func (s *ServerStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.IsNew && len(session.Values) == 0 {
+		return nil
+	}
+
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			if err := s.backend.DeleteSession(session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = strings.TrimRight(
+			base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+
+	email, _ := session.Values["email"].(string)
+	cookieOptions := *session.Options
+	if email == "" {
+		cookieOptions.MaxAge = min(cookieOptions.MaxAge, int(AnonymousSessionTTL.Seconds()))
+	}
+
+	record := models.SessionRecord{
+		ID:        session.ID,
+		UserEmail: email,
+		Data:      data,
+		UserAgent: r.UserAgent(),
+		IPAddress: ClientIP(r),
+		ExpiresAt: time.Now().Add(time.Duration(cookieOptions.MaxAge) * time.Second),
+	}
+	if err := s.backend.SaveSession(record); err != nil {
+		log.Printf("Error saving session: %v", err)
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, &cookieOptions))
+	return nil
+}
+
+// MaxAge sets the maximum age for the store and the underlying cookie
+// implementation
+func (s *ServerStore) MaxAge(age int) {
+	s.Options.MaxAge = age
+
+	for _, codec := range s.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+// ClientIP returns the client address of a request without its port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"supreme-broccoli/internal/database"
+	"supreme-broccoli/internal/models"
+)
+
+type memoryBackend struct {
+	records map[string]models.SessionRecord
+}
+
+func (m *memoryBackend) SaveSession(record models.SessionRecord) error {
+	m.records[record.ID] = record
+	return nil
+}
+
+func (m *memoryBackend) GetSession(id string) (models.SessionRecord, error) {
+	record, ok := m.records[id]
+	if !ok {
+		return models.SessionRecord{}, fmt.Errorf("session: %w", database.ErrNotFound)
+	}
+	return record, nil
+}
+
+func (m *memoryBackend) DeleteSession(id string) error {
+	delete(m.records, id)
+	return nil
+}
+
+func TestServerStoreRoundTripAndRevoke(t *testing.T) {
+	backend := &memoryBackend{records: map[string]models.SessionRecord{}}
+	store := NewSessionStore(backend, "test-key", false)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	session, err := store.Get(req, "auth-session")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	session.Values["email"] = "test@example.com"
+	if err := session.Save(req, rr); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	record, ok := backend.records[session.ID]
+	if !ok {
+		t.Fatal("Expected session record to be saved")
+	}
+	if record.UserEmail != "test@example.com" {
+		t.Errorf("Expected record email test@example.com, got %q", record.UserEmail)
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected 1 cookie, got %d", len(cookies))
+	}
+	if cookies[0].Value == session.ID {
+		t.Error("Expected cookie to carry a signed ID, not the raw session ID")
+	}
+
+	next := httptest.NewRequest("GET", "/", nil)
+	next.AddCookie(cookies[0])
+	loaded, err := store.Get(next, "auth-session")
+	if err != nil {
+		t.Fatalf("Get with cookie failed: %v", err)
+	}
+	if loaded.IsNew || loaded.Values["email"] != "test@example.com" {
+		t.Errorf("Expected stored session to be loaded, got %+v", loaded.Values)
+	}
+
+	// Revoking the record must invalidate the cookie
+	delete(backend.records, session.ID)
+	revoked := httptest.NewRequest("GET", "/", nil)
+	revoked.AddCookie(cookies[0])
+	fresh, err := store.Get(revoked, "auth-session")
+	if err != nil {
+		t.Fatalf("Get after revoke failed: %v", err)
+	}
+	if !fresh.IsNew || len(fresh.Values) != 0 {
+		t.Errorf("Expected a fresh session after revocation, got %+v", fresh.Values)
+	}
+}
+
+func TestServerStoreDeleteOnNegativeMaxAge(t *testing.T) {
+	backend := &memoryBackend{records: map[string]models.SessionRecord{}}
+	store := NewSessionStore(backend, "test-key", false)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	session, _ := store.Get(req, "auth-session")
+	session.Values["email"] = "test@example.com"
+	if err := session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	session.Options.MaxAge = -1
+	rr := httptest.NewRecorder()
+	if err := session.Save(req, rr); err != nil {
+		t.Fatalf("Save with MaxAge -1 failed: %v", err)
+	}
+	if len(backend.records) != 0 {
+		t.Errorf("Expected session record to be deleted, %d remain", len(backend.records))
+	}
+
+	cookie := rr.Result().Cookies()[0]
+	if cookie.MaxAge >= 0 || cookie.Value != "" {
+		t.Errorf("Expected cleared cookie, got %+v", cookie)
+	}
+}
+
+func TestServerStoreSkipsEmptyNewSession(t *testing.T) {
+	backend := &memoryBackend{records: map[string]models.SessionRecord{}}
+	store := NewSessionStore(backend, "test-key", false)
+
+	req := httptest.NewRequest("GET", "/contact", nil)
+	rr := httptest.NewRecorder()
+	session, _ := store.Get(req, "auth-session")
+	if err := session.Save(req, rr); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if len(backend.records) != 0 {
+		t.Errorf("Expected no session record for an empty new session, got %d", len(backend.records))
+	}
+	if len(rr.Result().Cookies()) != 0 {
+		t.Error("Expected no cookie for an empty new session")
+	}
+}
+
+func TestServerStoreCapsAnonymousSessions(t *testing.T) {
+	backend := &memoryBackend{records: map[string]models.SessionRecord{}}
+	store := NewSessionStore(backend, "test-key", false)
+
+	req := httptest.NewRequest("GET", "/auth/google", nil)
+	rr := httptest.NewRecorder()
+	session, _ := store.Get(req, "auth-session")
+	session.Values["oauth_state"] = "state"
+	if err := session.Save(req, rr); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	record := backend.records[session.ID]
+	if time.Until(record.ExpiresAt) > AnonymousSessionTTL {
+		t.Errorf("Expected anonymous record to expire within %v, got %v", AnonymousSessionTTL, record.ExpiresAt)
+	}
+	if cookie := rr.Result().Cookies()[0]; cookie.MaxAge != int(AnonymousSessionTTL.Seconds()) {
+		t.Errorf("Expected anonymous cookie MaxAge %v, got %d", AnonymousSessionTTL, cookie.MaxAge)
+	}
+
+	// Signing in extends the same session to the full lifetime
+	session.Values["email"] = "test@example.com"
+	if err := session.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if time.Until(backend.records[session.ID].ExpiresAt) < 24*time.Hour {
+		t.Errorf("Expected signed-in record to keep the full lifetime, got %v", backend.records[session.ID].ExpiresAt)
+	}
+}
+
+func TestServerStoreCookieFlags(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		store := NewSessionStore(&memoryBackend{records: map[string]models.SessionRecord{}}, "test-key", secure)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		rr := httptest.NewRecorder()
+		session, _ := store.Get(req, "auth-session")
+		session.Values["email"] = "test@example.com"
+		if err := session.Save(req, rr); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+
+		cookie := rr.Result().Cookies()[0]
+		if cookie.Secure != secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("secure=%v: unexpected cookie flags %+v", secure, cookie)
+		}
+	}
+}
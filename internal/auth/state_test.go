@@ -0,0 +1,46 @@
+package auth
+
+import "testing"
+
+// TestSafeReturnTo verifies only allowlisted same-origin paths are accepted
+func TestSafeReturnTo(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		ok   bool
+	}{
+		{"/courses", "/courses", true},
+		{"/courses/gcp-fundamentals/enroll", "/courses/gcp-fundamentals/enroll", true},
+		{"/terminal/", "/terminal/", true},
+		{"/terminal", "/terminal", true},
+		{"/admin/users?x=1", "/admin/users?x=1", true},
+		{"/coursesevil", "", false},
+		{"/logout", "", false},
+		{"", "", false},
+		{"https://evil.example/courses", "", false},
+		{"//evil.example/courses", "", false},
+		{"/\\evil.example", "", false},
+		{"courses", "", false},
+		{"/courses/../logout", "", false},
+		{"/courses/%2e%2e/admin", "", false},
+		{"/courses/%2E%2E/%2E%2E/logout", "", false},
+		{"/courses/./gcp-fundamentals", "", false},
+		{"/courses//evil", "", false},
+		{"/courses/gcp%20basics", "/courses/gcp%20basics", true},
+	}
+
+	for _, tt := range tests {
+		got, ok := SafeReturnTo(tt.raw, DefaultReturnToAllowlist)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("SafeReturnTo(%q) = %q, %v; expected %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// TestGenerateState verifies states are random
+func TestGenerateState(t *testing.T) {
+	a, b := GenerateState(), GenerateState()
+	if a == "" || a == b {
+		t.Errorf("Expected distinct non-empty states, got %q and %q", a, b)
+	}
+}
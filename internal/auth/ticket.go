@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTicketTTL is how long a terminal ticket can be redeemed after it is
+// issued
+const DefaultTicketTTL = 30 * time.Second
+
+// TicketStore issues short-lived, single-use tickets that a page passes to a
+// WebSocket handshake. Browsers attach cookies to cross-site WebSocket
+// requests, so the cookie alone does not prove the request came from our own
+// page; a ticket does, because other sites cannot read it.
+type TicketStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	tickets map[string]ticket
+}
+
+type ticket struct {
+	email     string
+	expiresAt time.Time
+}
+
+// NewTicketStore creates a store whose tickets expire after ttl
+func NewTicketStore(ttl time.Duration) *TicketStore {
+	return &TicketStore{
+		ttl:     ttl,
+		tickets: make(map[string]ticket),
+	}
+}
+
+// Issue creates a ticket for email
+func (s *TicketStore) Issue(email string) string {
+	value := GenerateState()
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, t := range s.tickets {
+		if now.After(t.expiresAt) {
+			delete(s.tickets, key)
+		}
+	}
+	s.tickets[value] = ticket{email: email, expiresAt: now.Add(s.ttl)}
+	return value
+}
+
+// Redeem consumes a ticket, reporting whether it was issued to email and has
+// not expired. A ticket can be redeemed only once, whatever the outcome.
+func (s *TicketStore) Redeem(value, email string) bool {
+	s.mu.Lock()
+	t, ok := s.tickets[value]
+	delete(s.tickets, value)
+	s.mu.Unlock()
+
+	return ok && time.Now().Before(t.expiresAt) &&
+		subtle.ConstantTimeCompare([]byte(t.email), []byte(email)) == 1
+}
+
+// NewOriginCheck returns a WebSocket CheckOrigin function accepting requests
+// from the application's own origin, taken from baseURL, and from the
+// allowed origins. Requests without an Origin header come from non-browser
+// clients, which cannot be used for cross-site attacks, and are accepted.
+func NewOriginCheck(baseURL string, allowed []string) (func(*http.Request) bool, error) {
+	origins := make(map[string]bool, len(allowed)+1)
+	for _, raw := range append([]string{baseURL}, allowed...) {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		origin, err := normalizeOrigin(raw)
+		if err != nil {
+			return nil, err
+		}
+		origins[origin] = true
+	}
+
+	return func(r *http.Request) bool {
+		header := r.Header.Get("Origin")
+		if header == "" {
+			return true
+		}
+		origin, err := normalizeOrigin(header)
+		return err == nil && origins[origin]
+	}, nil
+}
+
+// normalizeOrigin reduces a URL to its lowercase scheme://host[:port] form
+func normalizeOrigin(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid origin %q", raw)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
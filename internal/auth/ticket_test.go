@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTicketStoreSingleUse(t *testing.T) {
+	store := NewTicketStore(time.Minute)
+
+	ticket := store.Issue("a@example.com")
+	if store.Redeem(ticket, "b@example.com") {
+		t.Error("Expected a ticket to be rejected for another user")
+	}
+	if store.Redeem(ticket, "a@example.com") {
+		t.Error("Expected a ticket to be consumed by a failed redemption")
+	}
+
+	ticket = store.Issue("a@example.com")
+	if !store.Redeem(ticket, "a@example.com") {
+		t.Fatal("Expected a fresh ticket to be accepted")
+	}
+	if store.Redeem(ticket, "a@example.com") {
+		t.Error("Expected a ticket to be single-use")
+	}
+	if store.Redeem("", "a@example.com") {
+		t.Error("Expected an empty ticket to be rejected")
+	}
+}
+
+func TestTicketStoreExpiry(t *testing.T) {
+	store := NewTicketStore(10 * time.Millisecond)
+	ticket := store.Issue("a@example.com")
+	time.Sleep(20 * time.Millisecond)
+	if store.Redeem(ticket, "a@example.com") {
+		t.Error("Expected an expired ticket to be rejected")
+	}
+}
+
+func TestOriginCheck(t *testing.T) {
+	check, err := NewOriginCheck("https://lab.example.com/", []string{"http://localhost:8080"})
+	if err != nil {
+		t.Fatalf("NewOriginCheck failed: %v", err)
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"https://lab.example.com", true},
+		{"https://LAB.example.com", true},
+		{"http://localhost:8080", true},
+		{"http://lab.example.com", false},
+		{"https://lab.example.com.evil.example", false},
+		{"https://evil.example", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/ws", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if got := check(req); got != tt.want {
+			t.Errorf("Origin %q: got %v, expected %v", tt.origin, got, tt.want)
+		}
+	}
+
+	if _, err := NewOriginCheck("https://lab.example.com", []string{"lab.example.com"}); err == nil {
+		t.Error("Expected an origin without a scheme to be rejected")
+	}
+}
@@ -0,0 +1,96 @@
+// Package certs serves TLS certificates from files, picking up renewed
+// certificates without a restart
+package certs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is how often certificate files are checked for changes
+const DefaultReloadInterval = time.Minute
+
+// Reloader holds a certificate loaded from a certificate and key file and
+// reloads it when either file changes. If a changed pair fails to load, for
+// example because only one file has been replaced so far, the previous
+// certificate stays in use and loading is retried at the next check.
+type Reloader struct {
+	certFile, keyFile string
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	stamp string // sizes and modification times of the loaded files
+}
+
+// NewReloader loads the certificate and checks the files for changes every
+// interval
+func NewReloader(certFile, keyFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if _, err := r.reload(); err != nil {
+				log.Printf("Keeping the current TLS certificate: %v", err)
+			}
+		}
+	}()
+	return r, nil
+}
+
+// GetCertificate returns the current certificate. It is meant for
+// tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// reload loads the certificate if the files changed since it was last
+// loaded, reporting whether it did
+func (r *Reloader) reload() (bool, error) {
+	stamp, err := r.fileStamp()
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := stamp == r.stamp
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+
+	r.mu.Lock()
+	first := r.cert == nil
+	r.cert, r.stamp = &cert, stamp
+	r.mu.Unlock()
+
+	if !first {
+		log.Printf("Reloaded TLS certificate from %s", r.certFile)
+	}
+	return true, nil
+}
+
+// fileStamp identifies the current contents of both files
+func (r *Reloader) fileStamp() (string, error) {
+	var stamp string
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read TLS certificate: %v", err)
+		}
+		stamp += fmt.Sprintf("%d/%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
@@ -0,0 +1,109 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a new self-signed certificate for name and its key, with
+// the given modification time, and returns the certificate's DER bytes
+func writeCert(t *testing.T, certFile, keyFile, name string, modTime time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	writePEM(t, certFile, "CERTIFICATE", der, modTime)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER, modTime)
+	return der
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+}
+
+// current returns the DER bytes of the certificate being served
+func current(t *testing.T, r *Reloader) []byte {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil || cert == nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+
+	first := writeCert(t, certFile, keyFile, "first.example.com", start)
+	r, err := NewReloader(certFile, keyFile, time.Hour)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	if string(current(t, r)) != string(first) {
+		t.Fatal("Expected the initial certificate")
+	}
+
+	if reloaded, err := r.reload(); reloaded || err != nil {
+		t.Errorf("Expected no reload for unchanged files, got %v, %v", reloaded, err)
+	}
+
+	// A renewed certificate is picked up
+	second := writeCert(t, certFile, keyFile, "second.example.com", start.Add(time.Minute))
+	if reloaded, err := r.reload(); !reloaded || err != nil {
+		t.Fatalf("Expected a reload, got %v, %v", reloaded, err)
+	}
+	if string(current(t, r)) != string(second) {
+		t.Error("Expected the renewed certificate")
+	}
+
+	// A certificate whose key has not been replaced yet is not used
+	otherDir := t.TempDir()
+	writeCert(t, certFile, filepath.Join(otherDir, "key.pem"), "third.example.com", start.Add(2*time.Minute))
+	if _, err := r.reload(); err == nil {
+		t.Error("Expected a mismatched key to fail to load")
+	}
+	if string(current(t, r)) != string(second) {
+		t.Error("Expected the previous certificate to stay in use")
+	}
+}
+
+func TestNewReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), time.Hour); err == nil {
+		t.Error("Expected missing certificate files to be an error")
+	}
+}
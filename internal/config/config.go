@@ -1,43 +1,272 @@
 package config
 
 import (
-	"log"
+	"flag"
+	"fmt"
+	"net/url"
 	"os"
+	"slices"
+	"time"
 )
 
-// Config holds all application configuration
+// Config holds all application configuration.
+//
+// Each tagged field is read from, in increasing priority: its default, the
+// YAML config file, its environment variable and its command-line flag. The
+// env tag names the variable; the file key and flag are derived from it, so
+// TERMINAL_BACKEND is terminal_backend in the file and -terminal-backend on
+// the command line. Secret fields can't be set by flag, since flags show up
+// in process listings, and are redacted when the configuration is printed.
 type Config struct {
-	GoogleClientID     string
-	GoogleClientSecret string
-	SessionKey         string
-	AppBaseURL         string
-	MongoDBURI         string
-	ServerPort         string
+	GoogleClientID     string `env:"GOOGLE_CLIENT_ID" required:"true"`
+	GoogleClientSecret string `env:"GOOGLE_CLIENT_SECRET" required:"true" secret:"true"`
+	SessionKey         string `env:"SESSION_KEY" required:"true" secret:"true"`
+	AppBaseURL         string `env:"APP_BASE_URL" required:"true"`
+	// MongoDBURI may carry database credentials
+	MongoDBURI string `env:"DB_DSN" required:"true" secret:"true"`
+	ServerPort int    `env:"SERVER_PORT" default:"8080"`
+
+	// Native TLS. Certificates come either from TLSCertFile and TLSKeyFile,
+	// which are reloaded when they change, or from Let's Encrypt for
+	// TLSAutocertDomains, cached in TLSAutocertCacheDir.
+	TLSCertFile         string   `env:"TLS_CERT_FILE"`
+	TLSKeyFile          string   `env:"TLS_KEY_FILE"`
+	TLSAutocertDomains  []string `env:"TLS_AUTOCERT_DOMAINS"`
+	TLSAutocertCacheDir string   `env:"TLS_AUTOCERT_CACHE_DIR" default:"autocert-cache"`
+	TLSAutocertEmail    string   `env:"TLS_AUTOCERT_EMAIL"`
+	// HTTPRedirectPort, when set, serves plain HTTP on this port that
+	// redirects to HTTPS and answers Let's Encrypt challenges
+	HTTPRedirectPort int `env:"HTTP_REDIRECT_PORT"`
+	// HSTSMaxAge is sent in Strict-Transport-Security headers when
+	// AppBaseURL is HTTPS; zero leaves the header out
+	HSTSMaxAge time.Duration `env:"HSTS_MAX_AGE" default:"8760h"`
+
+	// TokenEncryptionKeys is a comma-separated list of id:base64key pairs used
+	// to encrypt OAuth tokens at rest. TokenEncryptionKeyID selects the key for
+	// new writes; it defaults to the last key listed.
+	TokenEncryptionKeys  string `env:"TOKEN_ENCRYPTION_KEYS" required:"true" secret:"true"`
+	TokenEncryptionKeyID string `env:"TOKEN_ENCRYPTION_KEY_ID"`
+
+	// TerminalBackend is the default backend for terminal sessions: cloudshell,
+	// local, docker or ssh. Courses may override it.
+	TerminalBackend string `env:"TERMINAL_BACKEND" default:"cloudshell"`
+	// TerminalShell enables the local backend, running this shell on the server
+	TerminalShell string `env:"TERMINAL_SHELL"`
+	// Docker backend; enabled when DockerImage is set
+	DockerImage  string `env:"TERMINAL_DOCKER_IMAGE"`
+	DockerMemory string `env:"TERMINAL_DOCKER_MEMORY"`
+	DockerCPUs   string `env:"TERMINAL_DOCKER_CPUS"`
+	// SSH backend; enabled when SSHHost is set
+	SSHHost           string `env:"TERMINAL_SSH_HOST"`
+	SSHPort           int    `env:"TERMINAL_SSH_PORT" default:"22"`
+	SSHUser           string `env:"TERMINAL_SSH_USER"`
+	SSHIdentityFile   string `env:"TERMINAL_SSH_IDENTITY_FILE"`
+	SSHKnownHostsFile string `env:"TERMINAL_SSH_KNOWN_HOSTS_FILE"`
+
+	// EditorPortMin and EditorPortMax bound the local ports Cloud Shell
+	// sessions forward their editor to, one port per session
+	EditorPortMin int `env:"EDITOR_PORT_MIN" default:"9100"`
+	EditorPortMax int `env:"EDITOR_PORT_MAX" default:"9199"`
+	// PreviewPorts are the ports in Cloud Shell that users may open through
+	// /preview/{port}/. Each is forwarded to a port from the editor range.
+	PreviewPorts []int `env:"PREVIEW_PORTS" default:"3000,5000,8000"`
+
+	// TerminalRecording decides which sessions are recorded: off, course (only
+	// courses that ask for it) or all. Recordings are written under RecordingsDir.
+	TerminalRecording string `env:"TERMINAL_RECORDING" default:"course"`
+	RecordingsDir     string `env:"RECORDINGS_DIR" default:"recordings"`
+
+	// Terminal session limits; zero disables a limit
+	TerminalMaxSessionsPerUser int           `env:"TERMINAL_MAX_SESSIONS_PER_USER" default:"3"`
+	TerminalMaxSessions        int           `env:"TERMINAL_MAX_SESSIONS" default:"100"`
+	TerminalIdleTimeout        time.Duration `env:"TERMINAL_IDLE_TIMEOUT" default:"30m"`
+	TerminalMaxDuration        time.Duration `env:"TERMINAL_MAX_DURATION" default:"8h"`
+
+	// TerminalCommandAudit records the commands run in terminal sessions,
+	// keeping them for TerminalCommandRetention. Secrets matching the built-in
+	// patterns, and those in TerminalAuditRedactFile, are redacted first.
+	TerminalCommandAudit     bool          `env:"TERMINAL_COMMAND_AUDIT" default:"on"`
+	TerminalCommandRetention time.Duration `env:"TERMINAL_COMMAND_RETENTION" default:"2160h"`
+	TerminalAuditRedactFile  string        `env:"TERMINAL_AUDIT_REDACT_FILE"`
+
+	// TerminalTransferMaxMB is the largest file, in megabytes, that may be
+	// uploaded into or downloaded from a terminal session
+	TerminalTransferMaxMB int `env:"TERMINAL_TRANSFER_MAX_MB" default:"100"`
+
+	// TerminalAllowedOrigins lists origins, besides AppBaseURL, whose pages
+	// may open terminal WebSockets
+	TerminalAllowedOrigins []string `env:"TERMINAL_ALLOWED_ORIGINS"`
+
+	// ConfigFile is the YAML file read, from -config or CONFIG_FILE
+	ConfigFile string
+	// PrintConfig asks for the effective configuration to be printed instead
+	// of starting the server; it is only set by the -print-config flag
+	PrintConfig bool
+
+	// sources records where each setting's value came from, by env name
+	sources map[string]string
 }
 
-// Load reads configuration from environment variables
-func Load() *Config {
-	cfg := &Config{
-		GoogleClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		GoogleClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		SessionKey:         os.Getenv("SESSION_KEY"),
-		AppBaseURL:         os.Getenv("APP_BASE_URL"),
-		MongoDBURI:         os.Getenv("DB_DSN"),
-		ServerPort:         getEnvOrDefault("SERVER_PORT", "8080"),
+// Where a setting's value came from
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// Load reads the configuration from defaults, the config file, environment
+// variables and the command-line arguments args, in that order. If the
+// configuration is invalid, the returned error is a *ValidationError listing
+// every problem, and the configuration is returned as well so it can still be
+// printed. A malformed command line returns only an error.
+func Load(args []string) (*Config, error) {
+	cfg := &Config{sources: make(map[string]string)}
+	settings := cfg.settings()
+	var problems []Problem
+
+	flags := flag.NewFlagSet("server", flag.ContinueOnError)
+	flags.StringVar(&cfg.ConfigFile, "config", os.Getenv("CONFIG_FILE"), "YAML config `file`")
+	flags.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective configuration, with secrets redacted, and exit")
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		if s.secret {
+			continue
+		}
+		flags.Func(s.flagName(), "overrides "+s.env, func(value string) error {
+			flagValues[s.env] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+
+	for _, s := range settings {
+		if s.def != "" {
+			problems = appendProblem(problems, cfg.apply(s, s.def, sourceDefault))
+		}
+	}
+
+	if cfg.ConfigFile != "" {
+		problems = append(problems, cfg.loadFile(settings)...)
+	}
+
+	for _, s := range settings {
+		// Empty variables are ignored, as .env files often leave them blank,
+		// except that an empty list clears it
+		if value, ok := os.LookupEnv(s.env); ok && (value != "" || s.isList()) {
+			problems = appendProblem(problems, cfg.apply(s, value, sourceEnv))
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := flagValues[s.env]; ok {
+			problems = appendProblem(problems, cfg.apply(s, value, sourceFlag))
+		}
 	}
 
-	// Validate required configuration
-	if cfg.GoogleClientID == "" || cfg.GoogleClientSecret == "" ||
-		cfg.SessionKey == "" || cfg.AppBaseURL == "" || cfg.MongoDBURI == "" {
-		log.Fatal("Required environment variables not set: GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET, SESSION_KEY, APP_BASE_URL, DB_DSN")
+	problems = append(problems, cfg.validate(settings)...)
+	if len(problems) > 0 {
+		return cfg, &ValidationError{Problems: problems}
 	}
+	return cfg, nil
+}
+
+// TLSEnabled reports whether the server terminates TLS itself
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || len(c.TLSAutocertDomains) > 0
+}
 
-	return cfg
+// HTTPS reports whether the site is served over HTTPS, either by this server
+// or by a proxy in front of it
+func (c *Config) HTTPS() bool {
+	u, err := url.Parse(c.AppBaseURL)
+	return err == nil && u.Scheme == "https"
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// validate checks the loaded values
+func (c *Config) validate(settings []*setting) []Problem {
+	var problems []Problem
+	invalid := func(env, format string, args ...any) {
+		problems = append(problems, Problem{Setting: env, Source: c.sources[env], Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, s := range settings {
+		if s.required && s.value.IsZero() {
+			invalid(s.env, "is required")
+		}
+	}
+
+	if c.AppBaseURL != "" {
+		if u, err := url.Parse(c.AppBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("APP_BASE_URL", "must be an http or https URL such as https://lab.example.com, got %q", c.AppBaseURL)
+		}
+	}
+
+	checkPort := func(env string, port int) {
+		if port < 1 || port > 65535 {
+			invalid(env, "must be a port from 1 to 65535, got %d", port)
+		}
+	}
+	checkPort("SERVER_PORT", c.ServerPort)
+	checkPort("TERMINAL_SSH_PORT", c.SSHPort)
+	checkPort("EDITOR_PORT_MIN", c.EditorPortMin)
+	checkPort("EDITOR_PORT_MAX", c.EditorPortMax)
+	if c.EditorPortMin > c.EditorPortMax {
+		invalid("EDITOR_PORT_MAX", "must not be below EDITOR_PORT_MIN (%d), got %d", c.EditorPortMin, c.EditorPortMax)
+	}
+	for _, port := range c.PreviewPorts {
+		checkPort("PREVIEW_PORTS", port)
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		invalid("TLS_KEY_FILE", "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.TLSCertFile != "" && len(c.TLSAutocertDomains) > 0 {
+		invalid("TLS_AUTOCERT_DOMAINS", "can't be used together with TLS_CERT_FILE")
+	}
+	if c.TLSEnabled() && c.AppBaseURL != "" && !c.HTTPS() {
+		invalid("APP_BASE_URL", "must be an https URL when TLS is enabled, got %q", c.AppBaseURL)
+	}
+	if c.HTTPRedirectPort != 0 {
+		checkPort("HTTP_REDIRECT_PORT", c.HTTPRedirectPort)
+		if !c.TLSEnabled() {
+			invalid("HTTP_REDIRECT_PORT", "needs TLS, from TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+		}
+		if c.HTTPRedirectPort == c.ServerPort {
+			invalid("HTTP_REDIRECT_PORT", "must differ from SERVER_PORT")
+		}
+	}
+
+	checkOneOf := func(env, value string, allowed ...string) {
+		if !slices.Contains(allowed, value) {
+			invalid(env, "must be one of %v, got %q", allowed, value)
+		}
 	}
-	return defaultValue
+	checkOneOf("TERMINAL_BACKEND", c.TerminalBackend, "cloudshell", "local", "docker", "ssh")
+	checkOneOf("TERMINAL_RECORDING", c.TerminalRecording, "off", "course", "all")
+
+	checkNotNegative := func(env string, n int64) {
+		if n < 0 {
+			invalid(env, "must not be negative")
+		}
+	}
+	checkNotNegative("TERMINAL_MAX_SESSIONS_PER_USER", int64(c.TerminalMaxSessionsPerUser))
+	checkNotNegative("TERMINAL_MAX_SESSIONS", int64(c.TerminalMaxSessions))
+	checkNotNegative("TERMINAL_IDLE_TIMEOUT", int64(c.TerminalIdleTimeout))
+	checkNotNegative("TERMINAL_MAX_DURATION", int64(c.TerminalMaxDuration))
+	checkNotNegative("HSTS_MAX_AGE", int64(c.HSTSMaxAge))
+
+	if c.TerminalCommandAudit && c.TerminalCommandRetention <= 0 {
+		invalid("TERMINAL_COMMAND_RETENTION", "must be positive while TERMINAL_COMMAND_AUDIT is on")
+	}
+	if c.TerminalTransferMaxMB < 1 {
+		invalid("TERMINAL_TRANSFER_MAX_MB", "must be at least 1, got %d", c.TerminalTransferMaxMB)
+	}
+
+	return problems
 }
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setRequired sets the required settings in the environment
+func setRequired(t *testing.T) {
+	t.Helper()
+	t.Setenv("GOOGLE_CLIENT_ID", "client-id")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "client-secret")
+	t.Setenv("SESSION_KEY", "session-key")
+	t.Setenv("APP_BASE_URL", "https://lab.example.com")
+	t.Setenv("DB_DSN", "mongodb://user:pass@db")
+	t.Setenv("TOKEN_ENCRYPTION_KEYS", "k1:c2VjcmV0")
+}
+
+// writeConfigFile writes a config file for the test and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	setRequired(t)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.ServerPort != 8080 || cfg.TerminalBackend != "cloudshell" || cfg.TerminalIdleTimeout != 30*time.Minute {
+		t.Errorf("Unexpected defaults: port %d, backend %q, idle timeout %v", cfg.ServerPort, cfg.TerminalBackend, cfg.TerminalIdleTimeout)
+	}
+	if !cfg.TerminalCommandAudit || !slices.Equal(cfg.PreviewPorts, []int{3000, 5000, 8000}) {
+		t.Errorf("Unexpected defaults: audit %v, preview ports %v", cfg.TerminalCommandAudit, cfg.PreviewPorts)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	setRequired(t)
+	path := writeConfigFile(t, `
+terminal_backend: docker
+terminal_idle_timeout: 10m
+terminal_max_sessions: 20
+preview_ports: [8000, 8080]
+terminal_command_audit: off
+`)
+	t.Setenv("TERMINAL_IDLE_TIMEOUT", "15m")
+	t.Setenv("TERMINAL_MAX_SESSIONS", "")    // empty variables are ignored
+	t.Setenv("TERMINAL_ALLOWED_ORIGINS", "") // except for lists
+
+	cfg, err := Load([]string{"-config", path, "-terminal-backend", "ssh"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.TerminalBackend != "ssh" {
+		t.Errorf("Expected the flag to override the file, got backend %q", cfg.TerminalBackend)
+	}
+	if cfg.TerminalIdleTimeout != 15*time.Minute {
+		t.Errorf("Expected the environment to override the file, got %v", cfg.TerminalIdleTimeout)
+	}
+	if cfg.TerminalMaxSessions != 20 || !slices.Equal(cfg.PreviewPorts, []int{8000, 8080}) || cfg.TerminalCommandAudit {
+		t.Errorf("Expected values from the file, got max sessions %d, preview ports %v, audit %v",
+			cfg.TerminalMaxSessions, cfg.PreviewPorts, cfg.TerminalCommandAudit)
+	}
+	if cfg.ServerPort != 8080 {
+		t.Errorf("Expected the default port, got %d", cfg.ServerPort)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	setRequired(t)
+	t.Setenv("GOOGLE_CLIENT_ID", "")
+	t.Setenv("TERMINAL_IDLE_TIMEOUT", "soon")
+	t.Setenv("EDITOR_PORT_MIN", "9200")
+	path := writeConfigFile(t, "terminal_recording: sometimes\nunknown_key: 1\n")
+
+	cfg, err := Load([]string{"-config", path, "-server-port", "http"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	if cfg == nil {
+		t.Fatal("Expected the configuration to be returned with the error")
+	}
+
+	want := map[string]string{
+		"GOOGLE_CLIENT_ID":      "",
+		"TERMINAL_IDLE_TIMEOUT": "env",
+		"EDITOR_PORT_MAX":       "default",
+		"TERMINAL_RECORDING":    "file " + path,
+		"unknown_key":           "file " + path,
+		"SERVER_PORT":           "flag",
+	}
+	for _, p := range verr.Problems {
+		source, ok := want[p.Setting]
+		if !ok {
+			t.Errorf("Unexpected problem %s", p)
+			continue
+		}
+		if p.Source != source {
+			t.Errorf("Expected %s to come from %q, got %s", p.Setting, source, p)
+		}
+		delete(want, p.Setting)
+	}
+	for setting := range want {
+		t.Errorf("Expected a problem with %s", setting)
+	}
+}
+
+func TestLoadRejectsSecretFlags(t *testing.T) {
+	setRequired(t)
+	if _, err := Load([]string{"-session-key", "abc"}); err == nil {
+		t.Error("Expected secrets to be refused on the command line")
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	setRequired(t)
+	cfg, err := Load([]string{"-print-config"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.PrintConfig {
+		t.Error("Expected -print-config to be recorded")
+	}
+
+	var out strings.Builder
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Print failed: %v", err)
+	}
+	printed := out.String()
+	for _, secret := range []string{"client-secret", "session-key", "user:pass", "c2VjcmV0"} {
+		if strings.Contains(printed, secret) {
+			t.Errorf("Secret %q printed:\n%s", secret, printed)
+		}
+	}
+	for _, line := range []string{"google_client_id: client-id # env", "db_dsn: '[REDACTED]' # env", "terminal_idle_timeout: 30m0s # default"} {
+		if !strings.Contains(printed, line) {
+			t.Errorf("Expected %q in:\n%s", line, printed)
+		}
+	}
+
+	// The printed configuration is itself a valid config file
+	path := writeConfigFile(t, strings.ReplaceAll(printed, "'[REDACTED]'", "secret"))
+	if _, err := Load([]string{"-config", path}); err != nil {
+		t.Errorf("Failed to load the printed configuration: %v", err)
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	setRequired(t)
+	t.Setenv("TLS_CERT_FILE", "/etc/cloudlab/cert.pem")
+	t.Setenv("TLS_KEY_FILE", "/etc/cloudlab/key.pem")
+	t.Setenv("HTTP_REDIRECT_PORT", "8080")
+
+	cfg, err := Load([]string{"-server-port", "8443"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.TLSEnabled() || !cfg.HTTPS() || cfg.HSTSMaxAge != 8760*time.Hour {
+		t.Errorf("Expected TLS and HTTPS with the default HSTS max age, got %v, %v, %v", cfg.TLSEnabled(), cfg.HTTPS(), cfg.HSTSMaxAge)
+	}
+
+	// TLS on a plain http base URL, a missing key and a clashing redirect port
+	t.Setenv("APP_BASE_URL", "http://lab.example.com")
+	t.Setenv("TLS_KEY_FILE", "")
+	_, err = Load(nil)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Problems) != 3 {
+		t.Errorf("Expected three problems, got %v", err)
+	}
+}
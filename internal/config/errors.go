@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Problem is one thing wrong with the configuration
+type Problem struct {
+	Setting string // environment variable name of the setting
+	Source  string // where the bad value came from, if it was set
+	Message string
+}
+
+// String describes the problem, e.g. "TERMINAL_IDLE_TIMEOUT (env): must be
+// a duration such as 30m or 8h, got \"soon\""
+func (p Problem) String() string {
+	if p.Source == "" {
+		return p.Setting + ": " + p.Message
+	}
+	return fmt.Sprintf("%s (%s): %s", p.Setting, p.Source, p.Message)
+}
+
+// ValidationError lists every problem found while loading the configuration
+type ValidationError struct {
+	Problems []Problem
+}
+
+// Error implements error
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = "  " + p.String()
+	}
+	return fmt.Sprintf("%d configuration problem(s):\n%s", len(e.Problems), strings.Join(lines, "\n"))
+}
+
+// appendProblem appends p to problems if it is not nil
+func appendProblem(problems []Problem, p *Problem) []Problem {
+	if p == nil {
+		return problems
+	}
+	return append(problems, *p)
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values when the configuration is printed
+const redacted = "[REDACTED]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setting is one tagged Config field
+type setting struct {
+	env      string
+	def      string
+	required bool
+	secret   bool
+	value    reflect.Value
+}
+
+// settings lists the tagged fields of c in declaration order
+func (c *Config) settings() []*setting {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	var settings []*setting
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		env := field.Tag.Get("env")
+		if env == "" {
+			continue
+		}
+		settings = append(settings, &setting{
+			env:      env,
+			def:      field.Tag.Get("default"),
+			required: field.Tag.Get("required") == "true",
+			secret:   field.Tag.Get("secret") == "true",
+			value:    v.Field(i),
+		})
+	}
+	return settings
+}
+
+// key is the setting's name in the config file
+func (s *setting) key() string {
+	return strings.ToLower(s.env)
+}
+
+// flagName is the setting's command-line flag
+func (s *setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.env), "_", "-")
+}
+
+// isList reports whether the setting holds a comma-separated list
+func (s *setting) isList() bool {
+	return s.value.Kind() == reflect.Slice
+}
+
+// apply parses raw into the setting, recording where it came from
+func (c *Config) apply(s *setting, raw, source string) *Problem {
+	if err := s.set(raw); err != nil {
+		return &Problem{Setting: s.env, Source: source, Message: err.Error()}
+	}
+	c.sources[s.env] = source
+	return nil
+}
+
+// set parses raw according to the setting's type
+func (s *setting) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch {
+	case s.value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 30m or 8h, got %q", raw)
+		}
+		s.value.SetInt(int64(d))
+	case s.value.Kind() == reflect.String:
+		s.value.SetString(raw)
+	case s.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("must be a whole number, got %q", raw)
+		}
+		s.value.SetInt(int64(n))
+	case s.value.Kind() == reflect.Bool:
+		b, err := parseBool(raw)
+		if err != nil {
+			return err
+		}
+		s.value.SetBool(b)
+	case s.value.Kind() == reflect.Slice:
+		items := splitList(raw)
+		list := reflect.MakeSlice(s.value.Type(), len(items), len(items))
+		for i, item := range items {
+			switch s.value.Type().Elem().Kind() {
+			case reflect.String:
+				list.Index(i).SetString(item)
+			case reflect.Int:
+				n, err := strconv.Atoi(item)
+				if err != nil {
+					return fmt.Errorf("must be a comma-separated list of whole numbers, got %q", raw)
+				}
+				list.Index(i).SetInt(int64(n))
+			}
+		}
+		s.value.Set(list)
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+// format renders the setting's value the way it would be written in the
+// config file
+func (s *setting) format() string {
+	if s.value.Type() == durationType {
+		return time.Duration(s.value.Int()).String()
+	}
+	return fmt.Sprint(s.value.Interface())
+}
+
+// parseBool accepts the on/off spellings used by feature flags as well as
+// true/false
+func parseBool(raw string) (bool, error) {
+	switch strings.ToLower(raw) {
+	case "on", "true", "yes", "1":
+		return true, nil
+	case "off", "false", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("must be on or off, got %q", raw)
+}
+
+// splitList splits a comma-separated value, dropping empty entries
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadFile applies the settings in the YAML config file. Values are written
+// as they would be in environment variables; lists may also be YAML
+// sequences.
+func (c *Config) loadFile(settings []*setting) []Problem {
+	source := sourceFile + " " + c.ConfigFile
+	fileProblem := func(key, format string, args ...any) []Problem {
+		return []Problem{{Setting: key, Source: source, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	data, err := os.ReadFile(c.ConfigFile)
+	if err != nil {
+		return fileProblem("CONFIG_FILE", "failed to read config file: %v", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fileProblem("CONFIG_FILE", "failed to parse config file: %v", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fileProblem("CONFIG_FILE", "config file must be a mapping of settings")
+	}
+
+	byKey := make(map[string]*setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key()] = s
+	}
+
+	var problems []Problem
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, node := root.Content[i].Value, root.Content[i+1]
+		s, ok := byKey[key]
+		if !ok {
+			problems = append(problems, fileProblem(key, "unknown setting")...)
+			continue
+		}
+
+		var raw string
+		switch {
+		case node.Kind == yaml.ScalarNode:
+			raw = node.Value
+		case node.Kind == yaml.SequenceNode && s.isList():
+			items := make([]string, 0, len(node.Content))
+			for _, item := range node.Content {
+				items = append(items, item.Value)
+			}
+			raw = strings.Join(items, ",")
+		default:
+			problems = append(problems, fileProblem(s.env, "line %d: expected a single value", node.Line)...)
+			continue
+		}
+		problems = appendProblem(problems, c.apply(s, raw, source))
+	}
+	return problems
+}
+
+// Print writes the effective configuration as a YAML config file, noting
+// where each value came from. Secrets are redacted.
+func (c *Config) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range c.settings() {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: s.key()}
+		source := c.sources[s.env]
+		if source == "" {
+			source = "unset"
+		}
+
+		var value *yaml.Node
+		switch {
+		case s.secret:
+			text := ""
+			if !s.value.IsZero() {
+				text = redacted
+			}
+			value = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: text}
+		case s.isList():
+			value = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for i := 0; i < s.value.Len(); i++ {
+				value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(s.value.Index(i).Interface())})
+			}
+		case s.value.Kind() == reflect.String:
+			value = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s.format()}
+		default:
+			value = &yaml.Node{Kind: yaml.ScalarNode, Value: s.format()}
+		}
+		value.LineComment = source
+		root.Content = append(root.Content, key, value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return fmt.Errorf("failed to print configuration: %v", err)
+	}
+	return enc.Close()
+}
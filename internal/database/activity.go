@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"supreme-broccoli/internal/models"
+)
+
+// maxStreakDays bounds how far back active days are loaded for streaks
+const maxStreakDays = 366
+
+// RecordActivity stores an activity event, stamping it with the current time if unset
+func (db *MongoDB) RecordActivity(event models.ActivityEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	if _, err := db.ActivityCollection.InsertOne(ctx, event); err != nil {
+		return fmt.Errorf("failed to record %s activity for %s: %v", event.Type, event.UserEmail, err)
+	}
+
+	return nil
+}
+
+// GetRecentActivity retrieves a user's most recent activity events
+func (db *MongoDB) GetRecentActivity(email string, limit int64) ([]models.ActivityEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := db.ActivityCollection.Find(ctx, bson.M{"user_email": email}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list activity for user %s: %v", email, err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.ActivityEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode activity for user %s: %v", email, err)
+	}
+
+	return events, nil
+}
+
+// GetActivitySummary aggregates a user's activity events into profile totals
+func (db *MongoDB) GetActivitySummary(email string) (models.ActivitySummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var summary models.ActivitySummary
+
+	// Enrolled courses: those whose latest enrollment event is an enrollment
+	enrolled, err := db.countAggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"user_email": email,
+			"type":       bson.M{"$in": bson.A{models.ActivityEnrollment, models.ActivityUnenrollment}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"created_at": 1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$course_id", "last": bson.M{"$last": "$type"}}}},
+		{{Key: "$match", Value: bson.M{"last": models.ActivityEnrollment}}},
+		{{Key: "$count", Value: "n"}},
+	})
+	if err != nil {
+		return summary, fmt.Errorf("failed to count enrollments for %s: %v", email, err)
+	}
+	summary.EnrolledCourses = enrolled
+
+	// Completed courses: distinct courses with a completion event
+	completed, err := db.countAggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_email": email, "type": models.ActivityCourseCompletion}}},
+		{{Key: "$group", Value: bson.M{"_id": "$course_id"}}},
+		{{Key: "$count", Value: "n"}},
+	})
+	if err != nil {
+		return summary, fmt.Errorf("failed to count completions for %s: %v", email, err)
+	}
+	summary.CompletedCourses = completed
+
+	// Learning time: total terminal session duration
+	cursor, err := db.ActivityCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_email": email, "type": models.ActivityTerminalSession}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$duration_seconds"}}}},
+	})
+	if err != nil {
+		return summary, fmt.Errorf("failed to sum terminal time for %s: %v", email, err)
+	}
+	var totals []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return summary, fmt.Errorf("failed to decode terminal time for %s: %v", email, err)
+	}
+	if len(totals) > 0 {
+		summary.TerminalSeconds = totals[0].Total
+	}
+
+	// Active days: distinct UTC dates with any activity
+	cursor, err = db.ActivityCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_email": email}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{
+			"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$created_at"},
+		}}}},
+		{{Key: "$sort", Value: bson.M{"_id": -1}}},
+		{{Key: "$limit", Value: maxStreakDays}},
+	})
+	if err != nil {
+		return summary, fmt.Errorf("failed to list active days for %s: %v", email, err)
+	}
+	var days []struct {
+		Day string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &days); err != nil {
+		return summary, fmt.Errorf("failed to decode active days for %s: %v", email, err)
+	}
+	for _, d := range days {
+		day, err := time.Parse("2006-01-02", d.Day)
+		if err != nil {
+			continue
+		}
+		summary.ActiveDays = append(summary.ActiveDays, day)
+	}
+
+	return summary, nil
+}
+
+// countAggregate runs a pipeline ending in {$count: "n"} against the activity collection
+func (db *MongoDB) countAggregate(ctx context.Context, pipeline mongo.Pipeline) (int, error) {
+	cursor, err := db.ActivityCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+
+	var result []struct {
+		N int `bson:"n"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+
+	return result[0].N, nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"supreme-broccoli/internal/models"
+)
+
+// CommandQuery filters the command audit log. Empty fields match everything.
+type CommandQuery struct {
+	UserEmail string
+	SessionID string
+	Text      string // case-insensitive substring of the command
+}
+
+// SaveCommand stores a command audit record
+func (db *MongoDB) SaveCommand(record models.CommandRecord) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.CommandsCollection.InsertOne(ctx, record); err != nil {
+		return fmt.Errorf("failed to save command for session %s: %v", record.SessionID, err)
+	}
+	return nil
+}
+
+// SearchCommands retrieves command audit records matching query, newest first
+func (db *MongoDB) SearchCommands(query CommandQuery, limit int64) ([]models.CommandRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if query.UserEmail != "" {
+		filter["user_email"] = query.UserEmail
+	}
+	if query.SessionID != "" {
+		filter["session_id"] = query.SessionID
+	}
+	if query.Text != "" {
+		filter["command"] = primitive.Regex{Pattern: regexp.QuoteMeta(query.Text), Options: "i"}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "executed_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := db.CommandsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search commands: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	records := []models.CommandRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode commands: %v", err)
+	}
+	return records, nil
+}
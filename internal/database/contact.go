@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"supreme-broccoli/internal/models"
+)
+
+// SaveContactMessage stores a new contact form submission
+func (db *MongoDB) SaveContactMessage(msg models.ContactMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if msg.ID == "" {
+		msg.ID = primitive.NewObjectID().Hex()
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	if msg.Status == "" {
+		msg.Status = models.ContactStatusNew
+	}
+
+	if _, err := db.ContactCollection.InsertOne(ctx, msg); err != nil {
+		return fmt.Errorf("failed to save contact message from %s: %v", msg.Email, err)
+	}
+
+	log.Printf("Saved contact message %s from %s", msg.ID, msg.Email)
+	return nil
+}
+
+// ListContactMessages retrieves contact messages newest first, optionally filtered by status
+func (db *MongoDB) ListContactMessages(status string, limit int64) ([]models.ContactMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := db.ContactCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contact messages: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	messages := []models.ContactMessage{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, fmt.Errorf("failed to decode contact messages: %v", err)
+	}
+
+	return messages, nil
+}
+
+// CountContactMessagesByStatus returns the number of contact messages in each status
+func (db *MongoDB) CountContactMessagesByStatus() (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := db.ContactCollection.Aggregate(ctx, bson.A{
+		bson.M{"$group": bson.M{"_id": "$status", "n": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count contact messages: %v", err)
+	}
+
+	var rows []struct {
+		Status string `bson:"_id"`
+		N      int    `bson:"n"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode contact message counts: %v", err)
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.N
+	}
+
+	return counts, nil
+}
+
+// UpdateContactMessageStatus changes the status of a contact message
+func (db *MongoDB) UpdateContactMessageStatus(id, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := db.ContactCollection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"status": status}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update contact message %s: %v", id, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("contact message %s: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
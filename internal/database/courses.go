@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"supreme-broccoli/internal/models"
+)
+
+// ListCourses retrieves every course in the catalog ordered by title
+func (db *MongoDB) ListCourses() ([]models.Course, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "title", Value: 1}})
+	cursor, err := db.CoursesCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list courses: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	courses := []models.Course{}
+	if err := cursor.All(ctx, &courses); err != nil {
+		return nil, fmt.Errorf("failed to decode courses: %v", err)
+	}
+
+	return courses, nil
+}
+
+// GetCourse retrieves a single course by ID
+func (db *MongoDB) GetCourse(id string) (models.Course, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var course models.Course
+	err := db.CoursesCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&course)
+	if err == mongo.ErrNoDocuments {
+		return models.Course{}, fmt.Errorf("course %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return models.Course{}, fmt.Errorf("failed to retrieve course %s: %v", id, err)
+	}
+
+	return course, nil
+}
+
+// CreateCourse inserts a new course into the catalog
+func (db *MongoDB) CreateCourse(course models.Course) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if course.ID == "" {
+		return fmt.Errorf("course ID is required")
+	}
+
+	_, err := db.CoursesCollection.InsertOne(ctx, course)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("course already exists: %s", course.ID)
+		}
+		return fmt.Errorf("failed to create course %s: %v", course.ID, err)
+	}
+
+	log.Printf("Created course: %s", course.ID)
+	return nil
+}
+
+// UpdateCourse replaces an existing course's details
+func (db *MongoDB) UpdateCourse(course models.Course) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := db.CoursesCollection.ReplaceOne(ctx, bson.M{"_id": course.ID}, course)
+	if err != nil {
+		return fmt.Errorf("failed to update course %s: %v", course.ID, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("course %s: %w", course.ID, ErrNotFound)
+	}
+
+	return nil
+}
+
+// DeleteCourse removes a course and all progress recorded against it
+func (db *MongoDB) DeleteCourse(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := db.CoursesCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete course %s: %v", id, err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("course %s: %w", id, ErrNotFound)
+	}
+
+	if _, err := db.ProgressCollection.DeleteMany(ctx, bson.M{"course_id": id}); err != nil {
+		return fmt.Errorf("failed to delete progress for course %s: %v", id, err)
+	}
+
+	log.Printf("Deleted course: %s", id)
+	return nil
+}
+
+// SeedCourses inserts the given courses when the catalog is empty
+func (db *MongoDB) SeedCourses(courses []models.Course) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := db.CoursesCollection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to count courses: %v", err)
+	}
+	if count > 0 || len(courses) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(courses))
+	for i, course := range courses {
+		docs[i] = course
+	}
+
+	if _, err := db.CoursesCollection.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("failed to seed courses: %v", err)
+	}
+
+	log.Printf("Seeded course catalog with %d courses", len(courses))
+	return nil
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -12,17 +13,31 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 
 	"supreme-broccoli/internal/models"
+	"supreme-broccoli/internal/secrets"
 )
 
+// ErrNotFound is returned when a requested document does not exist
+var ErrNotFound = errors.New("not found")
+
 // MongoDB holds the database connection and collections
 type MongoDB struct {
-	Client          *mongo.Client
-	Database        *mongo.Database
-	UsersCollection *mongo.Collection
+	Client                   *mongo.Client
+	Keyring                  *secrets.Keyring // encrypts OAuth tokens at rest
+	Database                 *mongo.Database
+	UsersCollection          *mongo.Collection
+	CoursesCollection        *mongo.Collection
+	ProgressCollection       *mongo.Collection
+	ActivityCollection       *mongo.Collection
+	ContactCollection        *mongo.Collection
+	SessionsCollection       *mongo.Collection
+	RecordingsCollection     *mongo.Collection
+	TerminalAccessCollection *mongo.Collection
+	CommandsCollection       *mongo.Collection
 }
 
-// Connect establishes a connection to MongoDB
-func Connect(uri string) (*MongoDB, error) {
+// Connect establishes a connection to MongoDB. OAuth tokens are encrypted
+// with keyring before being written to the users collection.
+func Connect(uri string, keyring *secrets.Keyring) (*MongoDB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -41,11 +56,98 @@ func Connect(uri string) (*MongoDB, error) {
 	log.Println("MongoDB connection established.")
 	log.Printf("Using database: %s, collection: %s", database.Name(), usersCollection.Name())
 
-	return &MongoDB{
-		Client:          client,
-		Database:        database,
-		UsersCollection: usersCollection,
-	}, nil
+	db := &MongoDB{
+		Client:                   client,
+		Keyring:                  keyring,
+		Database:                 database,
+		UsersCollection:          usersCollection,
+		CoursesCollection:        database.Collection("courses"),
+		ProgressCollection:       database.Collection("user_progress"),
+		ActivityCollection:       database.Collection("activity_events"),
+		ContactCollection:        database.Collection("contact_messages"),
+		SessionsCollection:       database.Collection("sessions"),
+		RecordingsCollection:     database.Collection("recordings"),
+		TerminalAccessCollection: database.Collection("terminal_access"),
+		CommandsCollection:       database.Collection("terminal_commands"),
+	}
+
+	if err := db.ensureIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// ensureIndexes creates the indexes the application relies on
+func (db *MongoDB) ensureIndexes(ctx context.Context) error {
+	_, err := db.ProgressCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_email", Value: 1}, {Key: "course_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create user_progress index: %v", err)
+	}
+
+	_, err = db.ActivityCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_email", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create activity_events index: %v", err)
+	}
+
+	_, err = db.ContactCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create contact_messages index: %v", err)
+	}
+
+	// Expired sessions are removed by MongoDB's TTL monitor
+	_, err = db.SessionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "user_email", Value: 1}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create sessions indexes: %v", err)
+	}
+
+	_, err = db.RecordingsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_email", Value: 1}, {Key: "started_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create recordings index: %v", err)
+	}
+
+	_, err = db.TerminalAccessCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create terminal_access index: %v", err)
+	}
+
+	// Commands past their retention period are removed by MongoDB's TTL monitor
+	_, err = db.CommandsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "user_email", Value: 1}, {Key: "executed_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "session_id", Value: 1}, {Key: "executed_at", Value: -1}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create terminal_commands indexes: %v", err)
+	}
+
+	return nil
 }
 
 // Close disconnects from MongoDB
@@ -61,18 +163,30 @@ func (db *MongoDB) Close() error {
 	return nil
 }
 
-// SaveUser saves or updates a user's tokens in the database
+// SaveUser saves or updates a user's tokens in the database. The role is
+// only set when the user is created; after that it is changed with
+// UpdateUserRole alone, so a login never overwrites an admin's change.
 func (db *MongoDB) SaveUser(user models.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	tokens, err := db.encryptTokens(user)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt tokens for user %s: %v", user.Email, err)
+	}
+
 	filter := bson.M{"_id": user.Email}
 	update := bson.M{
 		"$set": bson.M{
-			"access_token":  user.AccessToken,
-			"refresh_token": user.RefreshToken,
+			"access_token":  tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"token_key_id":  tokens.KeyID,
+			"token_dek":     tokens.WrappedKey,
 			"token_expiry":  user.TokenExpiry,
-			"role":          user.Role,
+		},
+		"$setOnInsert": bson.M{
+			"role":         user.Role,
+			"member_since": time.Now(),
 		},
 	}
 	opts := options.Update().SetUpsert(true)
@@ -97,6 +211,38 @@ func (db *MongoDB) SaveUser(user models.User) error {
 	return nil
 }
 
+// UpdateUserTokens saves refreshed OAuth tokens for an existing user,
+// leaving every other field as it is in the database
+func (db *MongoDB) UpdateUserTokens(user models.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tokens, err := db.encryptTokens(user)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt tokens for user %s: %v", user.Email, err)
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"access_token":  tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"token_key_id":  tokens.KeyID,
+			"token_dek":     tokens.WrappedKey,
+			"token_expiry":  user.TokenExpiry,
+		},
+	}
+
+	result, err := db.UsersCollection.UpdateOne(ctx, bson.M{"_id": user.Email}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update tokens for user %s: %v", user.Email, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user %s: %w", user.Email, ErrNotFound)
+	}
+
+	return nil
+}
+
 // GetUser retrieves a user's details from the database
 func (db *MongoDB) GetUser(email string) (models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -104,11 +250,11 @@ func (db *MongoDB) GetUser(email string) (models.User, error) {
 
 	filter := bson.M{"_id": email}
 
-	var user models.User
-	err := db.UsersCollection.FindOne(ctx, filter).Decode(&user)
+	var doc userDocument
+	err := db.UsersCollection.FindOne(ctx, filter).Decode(&doc)
 
 	if err == mongo.ErrNoDocuments {
-		return models.User{}, fmt.Errorf("user not found: %s", email)
+		return models.User{}, fmt.Errorf("user %s: %w", email, ErrNotFound)
 	}
 
 	if ctx.Err() == context.DeadlineExceeded {
@@ -119,5 +265,36 @@ func (db *MongoDB) GetUser(email string) (models.User, error) {
 		return models.User{}, fmt.Errorf("failed to retrieve user %s: %v", email, err)
 	}
 
-	return user, nil
+	if err := db.decryptTokens(&doc); err != nil {
+		return models.User{}, fmt.Errorf("failed to decrypt tokens for user %s: %v", email, err)
+	}
+
+	return doc.User, nil
+}
+
+// UpdateUserSettings stores a user's preferences on their user document
+func (db *MongoDB) UpdateUserSettings(email string, settings models.UserSettings) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": email}
+	update := bson.M{
+		"$set": bson.M{
+			"settings": settings,
+		},
+	}
+
+	result, err := db.UsersCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("database operation timeout for user: %s", email)
+		}
+		return fmt.Errorf("failed to update settings for user %s: %v", email, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user not found: %s", email)
+	}
+
+	return nil
 }
@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"supreme-broccoli/internal/models"
+)
+
+// GetUserProgress retrieves all progress records for a user
+func (db *MongoDB) GetUserProgress(email string) ([]models.UserProgress, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := db.ProgressCollection.Find(ctx, bson.M{"user_email": email})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list progress for user %s: %v", email, err)
+	}
+	defer cursor.Close(ctx)
+
+	progress := []models.UserProgress{}
+	if err := cursor.All(ctx, &progress); err != nil {
+		return nil, fmt.Errorf("failed to decode progress for user %s: %v", email, err)
+	}
+
+	return progress, nil
+}
+
+// GetProgress retrieves a user's progress in a single course
+func (db *MongoDB) GetProgress(email, courseID string) (models.UserProgress, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_email": email, "course_id": courseID}
+
+	var progress models.UserProgress
+	err := db.ProgressCollection.FindOne(ctx, filter).Decode(&progress)
+	if err == mongo.ErrNoDocuments {
+		return models.UserProgress{}, fmt.Errorf("progress for %s in course %s: %w", email, courseID, ErrNotFound)
+	}
+	if err != nil {
+		return models.UserProgress{}, fmt.Errorf("failed to retrieve progress for %s in course %s: %v", email, courseID, err)
+	}
+
+	return progress, nil
+}
+
+// SaveProgress creates or updates a user's progress in a course
+func (db *MongoDB) SaveProgress(progress models.UserProgress) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_email": progress.UserEmail, "course_id": progress.CourseID}
+	update := bson.M{
+		"$set": bson.M{
+			"progress":    progress.Progress,
+			"enrolled":    progress.Enrolled,
+			"last_access": progress.LastAccess,
+		},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	if _, err := db.ProgressCollection.UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf("failed to save progress for %s in course %s: %v", progress.UserEmail, progress.CourseID, err)
+	}
+
+	return nil
+}
+
+// EnrollUser marks a user as enrolled in a course. Enrolling twice is a no-op;
+// the returned bool reports whether this call changed the enrollment state.
+func (db *MongoDB) EnrollUser(email, courseID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"user_email": email, "course_id": courseID, "enrolled": bson.M{"$ne": true}}
+	update := bson.M{
+		"$set": bson.M{
+			"enrolled":    true,
+			"enrolled_at": now,
+			"last_access": now,
+		},
+		"$setOnInsert": bson.M{
+			"progress": 0,
+		},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	result, err := db.ProgressCollection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		// The filter skips records that are already enrolled, so the upsert
+		// collides with the unique (user_email, course_id) index instead
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to enroll %s in course %s: %v", email, courseID, err)
+	}
+
+	return result.UpsertedCount > 0 || result.ModifiedCount > 0, nil
+}
+
+// UnenrollUser marks a user as no longer enrolled in a course, keeping their
+// progress in case they enroll again. Unenrolling twice is a no-op.
+func (db *MongoDB) UnenrollUser(email, courseID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_email": email, "course_id": courseID, "enrolled": true}
+	update := bson.M{
+		"$set": bson.M{
+			"enrolled": false,
+		},
+	}
+
+	result, err := db.ProgressCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to unenroll %s from course %s: %v", email, courseID, err)
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// TouchProgress records that a user has just accessed an enrolled course
+func (db *MongoDB) TouchProgress(email, courseID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_email": email, "course_id": courseID, "enrolled": true}
+	update := bson.M{"$set": bson.M{"last_access": time.Now()}}
+
+	if _, err := db.ProgressCollection.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to update last access for %s in course %s: %v", email, courseID, err)
+	}
+
+	return nil
+}
+
+// CompleteModule records that a user finished a module of an enrolled course and
+// recalculates their progress. Completing the same module twice is a no-op; the
+// returned bool reports whether this call marked the module complete.
+func (db *MongoDB) CompleteModule(email, courseID string, module, totalModules int) (models.UserProgress, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"user_email":        email,
+		"course_id":         courseID,
+		"enrolled":          true,
+		"completed_modules": bson.M{"$ne": module},
+	}
+	update := bson.M{
+		"$addToSet": bson.M{"completed_modules": module},
+		"$set":      bson.M{"last_access": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var progress models.UserProgress
+	err := db.ProgressCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&progress)
+	if err == mongo.ErrNoDocuments {
+		// Either not enrolled or already complete; report the current state
+		current, getErr := db.GetProgress(email, courseID)
+		if getErr != nil {
+			return models.UserProgress{}, false, getErr
+		}
+		return current, false, nil
+	}
+	if err != nil {
+		return models.UserProgress{}, false, fmt.Errorf("failed to complete module %d of course %s for %s: %v", module, courseID, email, err)
+	}
+
+	if totalModules > 0 {
+		progress.Progress = len(progress.CompletedModules) * 100 / totalModules
+		if progress.Progress > 100 {
+			progress.Progress = 100
+		}
+	}
+
+	_, err = db.ProgressCollection.UpdateOne(ctx,
+		bson.M{"user_email": email, "course_id": courseID},
+		bson.M{"$set": bson.M{"progress": progress.Progress}},
+	)
+	if err != nil {
+		return progress, true, fmt.Errorf("failed to update progress of course %s for %s: %v", courseID, email, err)
+	}
+
+	return progress, true, nil
+}
+
+// RemapCourseProgress rewrites every user's completed modules in a course
+// after its modules were edited. moved maps each old module index to its new
+// one; completions of modules missing from it are dropped. Progress is then
+// recalculated against totalModules.
+func (db *MongoDB) RemapCourseProgress(courseID string, moved map[int]int, totalModules int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := db.ProgressCollection.Find(ctx, bson.M{"course_id": courseID})
+	if err != nil {
+		return fmt.Errorf("failed to list progress for course %s: %v", courseID, err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var progress models.UserProgress
+		if err := cursor.Decode(&progress); err != nil {
+			return fmt.Errorf("failed to decode progress for course %s: %v", courseID, err)
+		}
+
+		completed := []int{}
+		for _, module := range progress.CompletedModules {
+			if to, ok := moved[module]; ok {
+				completed = append(completed, to)
+			}
+		}
+		percent := 0
+		if totalModules > 0 {
+			percent = min(len(completed)*100/totalModules, 100)
+		}
+
+		_, err := db.ProgressCollection.UpdateOne(ctx,
+			bson.M{"user_email": progress.UserEmail, "course_id": courseID},
+			bson.M{"$set": bson.M{"completed_modules": completed, "progress": percent}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update progress of course %s for %s: %v", courseID, progress.UserEmail, err)
+		}
+	}
+
+	return cursor.Err()
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"supreme-broccoli/internal/models"
+)
+
+// SaveRecording stores the metadata of a new session recording
+func (db *MongoDB) SaveRecording(rec models.Recording) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.RecordingsCollection.InsertOne(ctx, rec); err != nil {
+		return fmt.Errorf("failed to save recording %s: %v", rec.ID, err)
+	}
+	return nil
+}
+
+// FinishRecording records the end time and final size of a recording
+func (db *MongoDB) FinishRecording(id string, endedAt time.Time, size int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"ended_at": endedAt, "size_bytes": size}}
+	result, err := db.RecordingsCollection.UpdateByID(ctx, id, update)
+	if err != nil {
+		return fmt.Errorf("failed to finish recording %s: %v", id, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("recording %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// GetRecording retrieves a recording's metadata by session ID
+func (db *MongoDB) GetRecording(id string) (models.Recording, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var rec models.Recording
+	err := db.RecordingsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&rec)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Recording{}, fmt.Errorf("recording %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return models.Recording{}, fmt.Errorf("failed to load recording %s: %v", id, err)
+	}
+	return rec, nil
+}
+
+// ListRecordings retrieves recordings newest first, optionally filtered by user
+func (db *MongoDB) ListRecordings(email string, limit int64) ([]models.Recording, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if email != "" {
+		filter["user_email"] = email
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := db.RecordingsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	recordings := []models.Recording{}
+	if err := cursor.All(ctx, &recordings); err != nil {
+		return nil, fmt.Errorf("failed to decode recordings: %v", err)
+	}
+	return recordings, nil
+}
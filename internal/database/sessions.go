@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"supreme-broccoli/internal/models"
+)
+
+// SaveSession creates or updates a server-side session record
+func (db *MongoDB) SaveSession(record models.SessionRecord) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"_id": record.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"user_email": record.UserEmail,
+			"data":       record.Data,
+			"user_agent": record.UserAgent,
+			"ip_address": record.IPAddress,
+			"updated_at": now,
+			"expires_at": record.ExpiresAt,
+		},
+		"$setOnInsert": bson.M{
+			"created_at": now,
+		},
+	}
+	opts := options.Update().SetUpsert(true)
+
+	if _, err := db.SessionsCollection.UpdateOne(ctx, filter, update, opts); err != nil {
+		return fmt.Errorf("failed to save session: %v", err)
+	}
+	return nil
+}
+
+// GetSession loads a session record by ID. Records past their expiry are
+// reported as ErrNotFound even if the TTL monitor has not removed them yet.
+func (db *MongoDB) GetSession(id string) (models.SessionRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var record models.SessionRecord
+	filter := bson.M{"_id": id, "expires_at": bson.M{"$gt": time.Now()}}
+	err := db.SessionsCollection.FindOne(ctx, filter).Decode(&record)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.SessionRecord{}, fmt.Errorf("session: %w", ErrNotFound)
+		}
+		return models.SessionRecord{}, fmt.Errorf("failed to load session: %v", err)
+	}
+	return record, nil
+}
+
+// DeleteSession removes a single session record
+func (db *MongoDB) DeleteSession(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.SessionsCollection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions revokes every session belonging to a user and returns
+// how many were removed
+func (db *MongoDB) DeleteUserSessions(email string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := db.SessionsCollection.DeleteMany(ctx, bson.M{"user_email": email})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions for user %s: %v", email, err)
+	}
+	return result.DeletedCount, nil
+}
+
+// ListUserSessions retrieves a user's unexpired sessions, most recently used first.
+// Session data is not included.
+func (db *MongoDB) ListUserSessions(email string) ([]models.SessionRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_email": email, "expires_at": bson.M{"$gt": time.Now()}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+		SetProjection(bson.M{"data": 0})
+
+	cursor, err := db.SessionsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions for user %s: %v", email, err)
+	}
+	defer cursor.Close(ctx)
+
+	records := []models.SessionRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %v", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"supreme-broccoli/internal/models"
+)
+
+// LogTerminalAccess stores a terminal access audit event, stamping it with
+// the current time if unset
+func (db *MongoDB) LogTerminalAccess(event models.TerminalAccessEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	if _, err := db.TerminalAccessCollection.InsertOne(ctx, event); err != nil {
+		return fmt.Errorf("failed to log terminal %s by %s: %v", event.Action, event.ActorEmail, err)
+	}
+	return nil
+}
+
+// ListTerminalAccess retrieves the most recent terminal access events
+func (db *MongoDB) ListTerminalAccess(limit int64) ([]models.TerminalAccessEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := db.TerminalAccessCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list terminal access events: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.TerminalAccessEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode terminal access events: %v", err)
+	}
+	return events, nil
+}
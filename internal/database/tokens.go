@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"supreme-broccoli/internal/models"
+)
+
+// userDocument is a users collection document including token encryption metadata.
+// Documents written before tokens were encrypted have an empty TokenKeyID.
+type userDocument struct {
+	models.User `bson:",inline"`
+	TokenKeyID  string `bson:"token_key_id,omitempty"`
+	TokenDEK    string `bson:"token_dek,omitempty"`
+}
+
+// encryptedTokens holds a user's OAuth tokens as stored in MongoDB
+type encryptedTokens struct {
+	AccessToken  string
+	RefreshToken string
+	KeyID        string
+	WrappedKey   string
+}
+
+// encryptTokens seals a user's OAuth tokens with the primary key. The user's
+// email is bound into the ciphertext so tokens cannot be copied between users.
+func (db *MongoDB) encryptTokens(user models.User) (encryptedTokens, error) {
+	if db.Keyring == nil {
+		return encryptedTokens{}, fmt.Errorf("no token encryption keyring configured")
+	}
+
+	keyID, wrappedKey, ciphertexts, err := db.Keyring.Encrypt(user.Email, user.AccessToken, user.RefreshToken)
+	if err != nil {
+		return encryptedTokens{}, err
+	}
+
+	return encryptedTokens{
+		AccessToken:  base64.StdEncoding.EncodeToString(ciphertexts[0]),
+		RefreshToken: base64.StdEncoding.EncodeToString(ciphertexts[1]),
+		KeyID:        keyID,
+		WrappedKey:   base64.StdEncoding.EncodeToString(wrappedKey),
+	}, nil
+}
+
+// decryptTokens replaces the encrypted tokens in doc with their plaintext.
+// Legacy plaintext documents are returned unchanged.
+func (db *MongoDB) decryptTokens(doc *userDocument) error {
+	if doc.TokenKeyID == "" {
+		return nil
+	}
+	if db.Keyring == nil {
+		return fmt.Errorf("no token encryption keyring configured")
+	}
+
+	wrappedKey, err := base64.StdEncoding.DecodeString(doc.TokenDEK)
+	if err != nil {
+		return fmt.Errorf("invalid wrapped key: %v", err)
+	}
+	access, err := base64.StdEncoding.DecodeString(doc.AccessToken)
+	if err != nil {
+		return fmt.Errorf("invalid access token ciphertext: %v", err)
+	}
+	refresh, err := base64.StdEncoding.DecodeString(doc.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("invalid refresh token ciphertext: %v", err)
+	}
+
+	plaintexts, err := db.Keyring.Decrypt(doc.TokenKeyID, wrappedKey, doc.Email, access, refresh)
+	if err != nil {
+		return err
+	}
+
+	doc.AccessToken = plaintexts[0]
+	doc.RefreshToken = plaintexts[1]
+	return nil
+}
+
+// ReencryptUserTokens rewrites every user's tokens under the primary key,
+// covering both legacy plaintext documents and documents sealed with an older
+// key. It is safe to run repeatedly; each document is updated only if it has
+// not changed since it was read.
+func (db *MongoDB) ReencryptUserTokens() (updated, skipped, failed int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	primary := db.Keyring.PrimaryKeyID()
+	filter := bson.M{"token_key_id": bson.M{"$ne": primary}}
+
+	cursor, err := db.UsersCollection.Find(ctx, filter)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to list users for re-encryption: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc userDocument
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Failed to decode user document: %v", err)
+			failed++
+			continue
+		}
+
+		previousKeyID := doc.TokenKeyID
+		previousAccess := doc.AccessToken
+
+		if err := db.decryptTokens(&doc); err != nil {
+			log.Printf("Failed to decrypt tokens for %s (key %q): %v", doc.Email, previousKeyID, err)
+			failed++
+			continue
+		}
+
+		tokens, err := db.encryptTokens(doc.User)
+		if err != nil {
+			log.Printf("Failed to encrypt tokens for %s: %v", doc.Email, err)
+			failed++
+			continue
+		}
+
+		// Only replace the exact version we read, so a concurrent login wins
+		match := bson.M{"_id": doc.Email, "access_token": previousAccess}
+		if previousKeyID == "" {
+			match["token_key_id"] = bson.M{"$exists": false}
+		} else {
+			match["token_key_id"] = previousKeyID
+		}
+
+		result, err := db.UsersCollection.UpdateOne(ctx, match, bson.M{
+			"$set": bson.M{
+				"access_token":  tokens.AccessToken,
+				"refresh_token": tokens.RefreshToken,
+				"token_key_id":  tokens.KeyID,
+				"token_dek":     tokens.WrappedKey,
+			},
+		})
+		if err != nil {
+			log.Printf("Failed to save re-encrypted tokens for %s: %v", doc.Email, err)
+			failed++
+			continue
+		}
+		if result.ModifiedCount == 0 {
+			skipped++
+			continue
+		}
+		updated++
+	}
+
+	if err := cursor.Err(); err != nil {
+		return updated, skipped, failed, fmt.Errorf("error iterating users: %v", err)
+	}
+
+	return updated, skipped, failed, nil
+}
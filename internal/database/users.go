@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"supreme-broccoli/internal/models"
+)
+
+// ListUsers retrieves all users ordered by email, without their OAuth tokens
+func (db *MongoDB) ListUsers() ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"access_token": 0, "refresh_token": 0})
+
+	cursor, err := db.UsersCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode users: %v", err)
+	}
+
+	return users, nil
+}
+
+// UpdateUserRole changes a user's role
+func (db *MongoDB) UpdateUserRole(email, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := db.UsersCollection.UpdateOne(ctx,
+		bson.M{"_id": email},
+		bson.M{"$set": bson.M{"role": role}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update role for user %s: %v", email, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user %s: %w", email, ErrNotFound)
+	}
+
+	return nil
+}
+
+// RecordLogin stamps a user's last login time
+func (db *MongoDB) RecordLogin(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.UsersCollection.UpdateOne(ctx,
+		bson.M{"_id": email},
+		bson.M{"$set": bson.M{"last_login": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record login for user %s: %v", email, err)
+	}
+
+	return nil
+}
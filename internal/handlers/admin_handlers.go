@@ -1,11 +1,612 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
+	"log"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"supreme-broccoli/internal/audit"
+	"supreme-broccoli/internal/database"
+	"supreme-broccoli/internal/helpers"
+	"supreme-broccoli/internal/middleware"
+	"supreme-broccoli/internal/models"
+	"supreme-broccoli/internal/recording"
+	"supreme-broccoli/internal/terminal"
 )
 
-// HandleAdmin serves the admin-only page
-func HandleAdmin(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintln(w, "Welcome to the Admin-Only Page!")
+// contactInboxLimit is the maximum number of messages shown in the admin inbox
+const contactInboxLimit = 200
+
+// recordingListLimit is the maximum number of recordings shown in the admin console
+const recordingListLimit = 200
+
+// commandListLimit is the maximum number of audited commands shown per search
+const commandListLimit = 500
+
+// accessLogLimit is the number of terminal access events shown on the sessions page
+const accessLogLimit = 50
+
+// courseIDPattern restricts course IDs to URL-friendly slugs
+var courseIDPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// errProgressNotRemapped reports a course that was saved but whose learners'
+// module completions could not be carried over to its new modules
+var errProgressNotRemapped = errors.New("learners' module progress was not updated to match")
+
+// AdminHandlers handles the admin console pages
+type AdminHandlers struct {
+	SessionStore sessions.Store
+	DB           *database.MongoDB
+	Users        *middleware.UserCache
+	Terminals    *terminal.Manager
+	Backends     *terminal.Backends
+	Recordings   *recording.Store
+	CommandAudit *audit.Policy
+	templates    *template.Template
+}
+
+// NewAdminHandlers creates a new AdminHandlers instance
+func NewAdminHandlers(sessionStore sessions.Store, db *database.MongoDB, users *middleware.UserCache, terminals *terminal.Manager, backends *terminal.Backends, recordings *recording.Store, commandAudit *audit.Policy) *AdminHandlers {
+	return &AdminHandlers{
+		SessionStore: sessionStore,
+		DB:           db,
+		Users:        users,
+		Terminals:    terminals,
+		Backends:     backends,
+		Recordings:   recordings,
+		CommandAudit: commandAudit,
+		templates:    parseTemplates(),
+	}
+}
+
+// HandleAdmin renders the admin dashboard (GET /admin)
+func (h *AdminHandlers) HandleAdmin(w http.ResponseWriter, r *http.Request) {
+	dashboardData := helpers.AdminDashboardPageData{
+		AdminPageData:  h.adminPageData(w, r, "dashboard"),
+		ActiveSessions: len(h.Terminals.List()),
+	}
+
+	users, err := h.DB.ListUsers()
+	if err != nil {
+		log.Printf("Error loading users: %v", err)
+	}
+	dashboardData.UserCount = len(users)
+	for _, user := range users {
+		if user.Role == models.RoleAdmin {
+			dashboardData.AdminCount++
+		}
+	}
+
+	courses, err := h.DB.ListCourses()
+	if err != nil {
+		log.Printf("Error loading courses: %v", err)
+	}
+	dashboardData.CourseCount = len(courses)
+
+	counts, err := h.DB.CountContactMessagesByStatus()
+	if err != nil {
+		log.Printf("Error counting contact messages: %v", err)
+	}
+	dashboardData.NewMessages = counts[models.ContactStatusNew]
+
+	h.render(w, "admin_dashboard.html", dashboardData)
+}
+
+// HandleUsers lists all users (GET /admin/users)
+func (h *AdminHandlers) HandleUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.DB.ListUsers()
+	if err != nil {
+		log.Printf("Error loading users: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	activeSessions := make(map[string]int)
+	for _, s := range h.Terminals.List() {
+		activeSessions[s.UserEmail]++
+	}
+
+	h.render(w, "admin_users.html", helpers.AdminUsersPageData{
+		AdminPageData:  h.adminPageData(w, r, "users"),
+		Users:          users,
+		ActiveSessions: activeSessions,
+	})
+}
+
+// HandleUserRole promotes or demotes a user (POST /admin/users/{email}/role)
+func (h *AdminHandlers) HandleUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email := r.PathValue("email")
+	role := r.FormValue("role")
+	if !models.IsValidRole(role) {
+		h.setSessionMessage(r, w, "", "Invalid role")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	// Stop admins from locking themselves out of the console
+	if current, _ := currentEmail(r); current == email && role != models.RoleAdmin {
+		h.setSessionMessage(r, w, "", "You cannot remove your own admin role")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	err := h.DB.UpdateUserRole(email, role)
+	if errors.Is(err, database.ErrNotFound) {
+		h.setSessionMessage(r, w, "", "User not found: "+email)
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating role for %s: %v", email, err)
+		h.setSessionMessage(r, w, "", "Failed to update role")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	// Apply the new role on this instance immediately rather than after the cache TTL
+	h.Users.Invalidate(email)
+
+	log.Printf("Role for %s changed to %s", email, role)
+	h.setSessionMessage(r, w, email+" is now "+role, "")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// HandleRevokeSessions signs a user out of every device
+// (POST /admin/users/{email}/sessions/revoke)
+func (h *AdminHandlers) HandleRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email := r.PathValue("email")
+	revoked, err := h.DB.DeleteUserSessions(email)
+	if err != nil {
+		log.Printf("Error revoking sessions for %s: %v", email, err)
+		h.setSessionMessage(r, w, "", "Failed to revoke sessions")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	log.Printf("Revoked %d session(s) for %s", revoked, email)
+	h.setSessionMessage(r, w, fmt.Sprintf("Signed %s out of %d session(s)", email, revoked), "")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// HandleSessions lists running terminal sessions (GET /admin/sessions)
+func (h *AdminHandlers) HandleSessions(w http.ResponseWriter, r *http.Request) {
+	accessLog, err := h.DB.ListTerminalAccess(accessLogLimit)
+	if err != nil {
+		log.Printf("Error loading terminal access log: %v", err)
+	}
+
+	h.render(w, "admin_sessions.html", helpers.AdminSessionsPageData{
+		AdminPageData: h.adminPageData(w, r, "sessions"),
+		Sessions:      h.Terminals.List(),
+		AccessLog:     accessLog,
+	})
+}
+
+// HandleRecordings lists terminal session recordings, optionally for a
+// single user (GET /admin/recordings?user=)
+func (h *AdminHandlers) HandleRecordings(w http.ResponseWriter, r *http.Request) {
+	userFilter := strings.TrimSpace(r.URL.Query().Get("user"))
+
+	recordings, err := h.DB.ListRecordings(userFilter, recordingListLimit)
+	if err != nil {
+		log.Printf("Error loading recordings: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, "admin_recordings.html", helpers.AdminRecordingsPageData{
+		AdminPageData: h.adminPageData(w, r, "recordings"),
+		Recordings:    recordings,
+		UserFilter:    userFilter,
+		Policy:        h.Recordings.Policy,
+	})
+}
+
+// HandleCommands searches the command audit log by user, session and
+// command text (GET /admin/commands?user=&session=&q=)
+func (h *AdminHandlers) HandleCommands(w http.ResponseWriter, r *http.Request) {
+	query := database.CommandQuery{
+		UserEmail: strings.TrimSpace(r.URL.Query().Get("user")),
+		SessionID: strings.TrimSpace(r.URL.Query().Get("session")),
+		Text:      strings.TrimSpace(r.URL.Query().Get("q")),
+	}
+
+	commands, err := h.DB.SearchCommands(query, commandListLimit)
+	if err != nil {
+		log.Printf("Error searching commands: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := helpers.AdminCommandsPageData{
+		AdminPageData: h.adminPageData(w, r, "commands"),
+		Commands:      commands,
+		UserFilter:    query.UserEmail,
+		SessionFilter: query.SessionID,
+		TextFilter:    query.Text,
+		Enabled:       h.CommandAudit != nil,
+	}
+	if h.CommandAudit != nil {
+		data.Retention = formatRetention(h.CommandAudit.Retention)
+	}
+	h.render(w, "admin_commands.html", data)
+}
+
+// formatRetention describes a retention period in days when it is a whole
+// number of them
+func formatRetention(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		if days := int(d / (24 * time.Hour)); days != 1 {
+			return fmt.Sprintf("%d days", days)
+		}
+		return "1 day"
+	}
+	return d.String()
+}
+
+// HandleCourses lists courses and creates new ones (GET, POST /admin/courses)
+func (h *AdminHandlers) HandleCourses(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		h.saveCourse(w, r, true)
+		return
+	}
+
+	courses, err := h.DB.ListCourses()
+	if err != nil {
+		log.Printf("Error loading courses: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, "admin_courses.html", helpers.AdminCoursesPageData{
+		AdminPageData: h.adminPageData(w, r, "courses"),
+		Courses:       courses,
+	})
+}
+
+// HandleNewCourse renders an empty course form (GET /admin/courses/new)
+func (h *AdminHandlers) HandleNewCourse(w http.ResponseWriter, r *http.Request) {
+	h.render(w, "admin_course_form.html", helpers.AdminCourseFormPageData{
+		AdminPageData:  h.adminPageData(w, r, "courses"),
+		Course:         models.Course{Level: "Beginner"},
+		IsNew:          true,
+		Backends:       h.Backends.Names(),
+		DefaultBackend: h.Backends.Default(),
+	})
+}
+
+// HandleCourse renders and updates an existing course (GET, POST /admin/courses/{id})
+func (h *AdminHandlers) HandleCourse(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		h.saveCourse(w, r, false)
+		return
+	}
+
+	course, err := h.DB.GetCourse(r.PathValue("id"))
+	if errors.Is(err, database.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading course: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.render(w, "admin_course_form.html", helpers.AdminCourseFormPageData{
+		AdminPageData:  h.adminPageData(w, r, "courses"),
+		Course:         course,
+		ModulesText:    formatModules(course.Modules),
+		Backends:       h.Backends.Names(),
+		DefaultBackend: h.Backends.Default(),
+	})
+}
+
+// HandleDeleteCourse removes a course (POST /admin/courses/{id}/delete)
+func (h *AdminHandlers) HandleDeleteCourse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := h.DB.DeleteCourse(id); err != nil {
+		log.Printf("Error deleting course %s: %v", id, err)
+		h.setSessionMessage(r, w, "", "Failed to delete course "+id)
+	} else {
+		h.setSessionMessage(r, w, "Deleted course "+id, "")
+	}
+	http.Redirect(w, r, "/admin/courses", http.StatusSeeOther)
+}
+
+// saveCourse validates the course form and creates or updates the course
+func (h *AdminHandlers) saveCourse(w http.ResponseWriter, r *http.Request, isNew bool) {
+	course, validationErr := parseCourseForm(r)
+	if !isNew {
+		course.ID = r.PathValue("id")
+	}
+	if validationErr == "" && course.Backend != "" {
+		if _, err := h.Backends.Get(course.Backend); err != nil {
+			validationErr = "Unknown terminal backend " + course.Backend
+		}
+	}
+
+	if validationErr == "" {
+		var err error
+		if isNew {
+			err = h.DB.CreateCourse(course)
+		} else {
+			err = h.updateCourse(course)
+		}
+		if err == nil {
+			h.setSessionMessage(r, w, "Saved course "+course.ID, "")
+			http.Redirect(w, r, "/admin/courses", http.StatusSeeOther)
+			return
+		}
+		if errors.Is(err, errProgressNotRemapped) {
+			// The course itself was saved, so don't offer the form again
+			log.Printf("Error remapping progress for course %s: %v", course.ID, err)
+			h.setSessionMessage(r, w, "", "Saved course "+course.ID+", but "+err.Error())
+			http.Redirect(w, r, "/admin/courses", http.StatusSeeOther)
+			return
+		}
+		log.Printf("Error saving course %s: %v", course.ID, err)
+		validationErr = "Failed to save course: " + err.Error()
+	}
+
+	// Re-render the form with the submitted values
+	formData := helpers.AdminCourseFormPageData{
+		AdminPageData:  h.adminPageData(w, r, "courses"),
+		Course:         course,
+		ModulesText:    r.FormValue("modules"),
+		IsNew:          isNew,
+		Backends:       h.Backends.Names(),
+		DefaultBackend: h.Backends.Default(),
+	}
+	formData.ErrorMessage = validationErr
+	w.WriteHeader(http.StatusBadRequest)
+	h.render(w, "admin_course_form.html", formData)
+}
+
+// updateCourse saves an edited course and carries users' completed modules
+// over to the new module list, since progress is kept by module index
+func (h *AdminHandlers) updateCourse(course models.Course) error {
+	old, err := h.DB.GetCourse(course.ID)
+	if err != nil {
+		return err
+	}
+	if err := h.DB.UpdateCourse(course); err != nil {
+		return err
+	}
+
+	moved := remapModules(old.Modules, course.Modules)
+	if len(moved) == len(old.Modules) && len(old.Modules) == len(course.Modules) && unmoved(moved) {
+		return nil
+	}
+	if err := h.DB.RemapCourseProgress(course.ID, moved, len(course.Modules)); err != nil {
+		return fmt.Errorf("%w: %v", errProgressNotRemapped, err)
+	}
+	return nil
+}
+
+// parseCourseForm parses and validates course fields from form data
+func parseCourseForm(r *http.Request) (models.Course, string) {
+	course := models.Course{
+		ID:          strings.TrimSpace(r.FormValue("id")),
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Instructor:  strings.TrimSpace(r.FormValue("instructor")),
+		Duration:    strings.TrimSpace(r.FormValue("duration")),
+		Level:       r.FormValue("level"),
+		Thumbnail:   strings.TrimSpace(r.FormValue("thumbnail")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Modules:     parseModules(r.FormValue("modules")),
+		Backend:     r.FormValue("backend"),
+		Record:      r.FormValue("record") == "on",
+	}
+
+	if r.PathValue("id") == "" && !courseIDPattern.MatchString(course.ID) {
+		return course, "Course ID must be lowercase letters, numbers and dashes"
+	}
+	if course.Title == "" {
+		return course, "Title is required"
+	}
+	if course.Instructor == "" {
+		return course, "Instructor is required"
+	}
+	validLevels := map[string]bool{"Beginner": true, "Intermediate": true, "Advanced": true}
+	if !validLevels[course.Level] {
+		return course, "Invalid level"
+	}
+
+	return course, ""
+}
+
+// parseModules reads one module per line in the form "Title | Description"
+func parseModules(text string) []models.Module {
+	modules := []models.Module{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		title, description, _ := strings.Cut(line, "|")
+		modules = append(modules, models.Module{
+			Title:       strings.TrimSpace(title),
+			Description: strings.TrimSpace(description),
+		})
+	}
+	return modules
+}
+
+// remapModules maps each old module index to its index in updated. Modules
+// are matched by title, so reordering keeps completions with their module; a
+// module renamed in place keeps its position. Removed modules are left out.
+func remapModules(old, updated []models.Module) map[int]int {
+	oldTitles := make(map[string]bool, len(old))
+	for _, m := range old {
+		oldTitles[m.Title] = true
+	}
+	used := make(map[int]bool, len(updated))
+	moved := make(map[int]int, len(old))
+
+	for i, m := range old {
+		for j, u := range updated {
+			if !used[j] && u.Title == m.Title {
+				moved[i], used[j] = j, true
+				break
+			}
+		}
+	}
+	for i := range old {
+		if _, ok := moved[i]; ok {
+			continue
+		}
+		if i < len(updated) && !used[i] && !oldTitles[updated[i].Title] {
+			moved[i], used[i] = i, true
+		}
+	}
+	return moved
+}
+
+// unmoved reports whether every module kept its index
+func unmoved(moved map[int]int) bool {
+	for from, to := range moved {
+		if from != to {
+			return false
+		}
+	}
+	return true
+}
+
+// formatModules is the inverse of parseModules
+func formatModules(modules []models.Module) string {
+	lines := make([]string, len(modules))
+	for i, m := range modules {
+		lines[i] = m.Title
+		if m.Description != "" {
+			lines[i] += " | " + m.Description
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HandleMessages renders the contact message inbox (GET /admin/messages)
+func (h *AdminHandlers) HandleMessages(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !models.IsValidContactStatus(status) {
+		status = ""
+	}
+
+	messages, err := h.DB.ListContactMessages(status, contactInboxLimit)
+	if err != nil {
+		log.Printf("Error loading contact messages: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	counts, err := h.DB.CountContactMessagesByStatus()
+	if err != nil {
+		log.Printf("Error counting contact messages: %v", err)
+	}
+
+	h.render(w, "admin_messages.html", helpers.AdminMessagesPageData{
+		AdminPageData: h.adminPageData(w, r, "messages"),
+		Messages:      messages,
+		StatusFilter:  status,
+		Counts:        counts,
+	})
+}
+
+// HandleMessageStatus updates a contact message's status (POST /admin/messages/{id}/status)
+func (h *AdminHandlers) HandleMessageStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := r.FormValue("status")
+	if !models.IsValidContactStatus(status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	err := h.DB.UpdateContactMessageStatus(r.PathValue("id"), status)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating contact message: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Return to the same filtered view
+	redirect := "/admin/messages"
+	if filter := r.FormValue("filter"); models.IsValidContactStatus(filter) {
+		redirect += "?status=" + filter
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// adminPageData builds the shared admin page data, consuming any flash messages
+func (h *AdminHandlers) adminPageData(w http.ResponseWriter, r *http.Request, section string) helpers.AdminPageData {
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "admin")
+
+	session, _ := h.SessionStore.Get(r, "auth-session")
+	successMsg, _ := session.Values["success_message"].(string)
+	errorMsg, _ := session.Values["error_message"].(string)
+	if successMsg != "" || errorMsg != "" {
+		delete(session.Values, "success_message")
+		delete(session.Values, "error_message")
+		session.Save(r, w)
+	}
+
+	return helpers.AdminPageData{
+		PageData:       *pageData,
+		AdminSection:   section,
+		SuccessMessage: successMsg,
+		ErrorMessage:   errorMsg,
+	}
+}
+
+// setSessionMessage sets a success or error message in the session
+func (h *AdminHandlers) setSessionMessage(r *http.Request, w http.ResponseWriter, success, error string) {
+	session, _ := h.SessionStore.Get(r, "auth-session")
+	if success != "" {
+		session.Values["success_message"] = success
+	}
+	if error != "" {
+		session.Values["error_message"] = error
+	}
+	session.Save(r, w)
+}
+
+// render executes an admin template
+func (h *AdminHandlers) render(w http.ResponseWriter, name string, data interface{}) {
+	if err := h.templates.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("Error rendering %s: %v", name, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
 }
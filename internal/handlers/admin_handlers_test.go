@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"supreme-broccoli/internal/models"
+)
+
+func TestRemapModules(t *testing.T) {
+	modules := func(titles ...string) []models.Module {
+		out := make([]models.Module, len(titles))
+		for i, title := range titles {
+			out[i] = models.Module{Title: title}
+		}
+		return out
+	}
+	old := modules("Setup", "Pods", "Services", "Config")
+
+	tests := []struct {
+		name    string
+		updated []models.Module
+		want    map[int]int
+	}{
+		{"unchanged", modules("Setup", "Pods", "Services", "Config"), map[int]int{0: 0, 1: 1, 2: 2, 3: 3}},
+		{"reordered", modules("Pods", "Setup", "Config", "Services"), map[int]int{0: 1, 1: 0, 2: 3, 3: 2}},
+		{"removed", modules("Setup", "Config"), map[int]int{0: 0, 3: 1}},
+		{"renamed in place", modules("Setup", "Pods and Deployments", "Services", "Config"), map[int]int{0: 0, 1: 1, 2: 2, 3: 3}},
+		{"inserted", modules("Setup", "Namespaces", "Pods", "Services", "Config"), map[int]int{0: 0, 1: 2, 2: 3, 3: 4}},
+		{"all removed", modules(), map[int]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := remapModules(old, tt.updated); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("remapModules() = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
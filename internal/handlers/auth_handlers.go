@@ -2,21 +2,28 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/sessions"
 	"golang.org/x/oauth2"
 	oauth2api "google.golang.org/api/oauth2/v2"
 	"google.golang.org/api/option"
 
+	"supreme-broccoli/internal/auth"
 	"supreme-broccoli/internal/database"
 	"supreme-broccoli/internal/models"
 )
 
+// oauthAttemptTTL bounds how long a login attempt may take to come back from
+// Google; the session holding it expires at the same time
+const oauthAttemptTTL = auth.AnonymousSessionTTL
+
 type AuthHandlers struct {
 	OAuthConfig  *oauth2.Config
-	SessionStore *sessions.CookieStore
+	SessionStore sessions.Store
 	DB           *database.MongoDB
 }
 
@@ -25,19 +32,69 @@ func (h *AuthHandlers) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "login.html")
 }
 
-// HandleGoogleLogin starts the OAuth flow
+// HandleGoogleLogin starts the OAuth flow with a per-attempt state and PKCE verifier
 func (h *AuthHandlers) HandleGoogleLogin(w http.ResponseWriter, r *http.Request) {
-	url := h.OAuthConfig.AuthCodeURL("state-string", oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+	state := auth.GenerateState()
+	verifier := oauth2.GenerateVerifier()
+
+	// Bind the attempt to this browser's session
+	session, _ := h.SessionStore.Get(r, "auth-session")
+	session.Values["oauth_state"] = state
+	session.Values["oauth_verifier"] = verifier
+	session.Values["oauth_started"] = time.Now().Unix()
+	delete(session.Values, "oauth_return_to")
+	if returnTo, ok := auth.SafeReturnTo(r.URL.Query().Get("return_to"), auth.DefaultReturnToAllowlist); ok {
+		session.Values["oauth_return_to"] = returnTo
+	}
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Failed to save session before OAuth redirect: %v", err)
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	url := h.OAuthConfig.AuthCodeURL(state,
+		oauth2.AccessTypeOffline,
+		oauth2.ApprovalForce,
+		oauth2.S256ChallengeOption(verifier),
+	)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
 // HandleGoogleCallback processes the OAuth callback
 func (h *AuthHandlers) HandleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
+
+	// Validate and consume the login attempt stored by HandleGoogleLogin
+	session, _ := h.SessionStore.Get(r, "auth-session")
+	expectedState, _ := session.Values["oauth_state"].(string)
+	verifier, _ := session.Values["oauth_verifier"].(string)
+	startedAt, _ := session.Values["oauth_started"].(int64)
+	returnTo, _ := session.Values["oauth_return_to"].(string)
+	delete(session.Values, "oauth_state")
+	delete(session.Values, "oauth_verifier")
+	delete(session.Values, "oauth_started")
+	delete(session.Values, "oauth_return_to")
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Failed to clear OAuth state from session: %v", err)
+	}
+
+	state := r.FormValue("state")
+	if expectedState == "" || verifier == "" ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(expectedState)) != 1 {
+		log.Printf("OAuth callback with missing or mismatched state")
+		http.Error(w, "Invalid login attempt. Please try signing in again.", http.StatusBadRequest)
+		return
+	}
+	if time.Since(time.Unix(startedAt, 0)) > oauthAttemptTTL {
+		log.Printf("OAuth callback for an expired login attempt")
+		http.Error(w, "Login attempt expired. Please try signing in again.", http.StatusBadRequest)
+		return
+	}
+
 	code := r.FormValue("code")
 
 	// Exchange code for token
-	token, err := h.OAuthConfig.Exchange(ctx, code)
+	token, err := h.OAuthConfig.Exchange(ctx, code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		log.Printf("Failed to exchange code: %v", err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -60,38 +117,51 @@ func (h *AuthHandlers) HandleGoogleCallback(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Save user to database
+	// Save user to database; a new user starts with the user role
 	user := models.User{
 		Email:        userInfo.Email,
 		AccessToken:  token.AccessToken,
 		RefreshToken: token.RefreshToken,
 		TokenExpiry:  token.Expiry,
-		Role:         "user",
-	}
-
-	// Preserve existing role if user exists
-	existingUser, err := h.DB.GetUser(user.Email)
-	if err == nil {
-		user.Role = existingUser.Role
+		Role:         models.RoleUser,
 	}
-
 	if err := h.DB.SaveUser(user); err != nil {
 		log.Printf("Failed to save user to DB: %v", err)
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	// Create session
-	session, _ := h.SessionStore.Get(r, "auth-session")
+	// The stored role is the one that counts for existing users
+	if existingUser, err := h.DB.GetUser(user.Email); err == nil {
+		user.Role = existingUser.Role
+	}
+
+	// Start from a clean session under a new ID so nothing set before login carries over
+	if session.ID != "" {
+		if err := h.DB.DeleteSession(session.ID); err != nil {
+			log.Printf("Failed to delete pre-login session: %v", err)
+		}
+		session.ID = ""
+	}
+	session.Values = make(map[interface{}]interface{})
 	session.Values["email"] = user.Email
 	session.Values["role"] = user.Role
 	if err := session.Save(r, w); err != nil {
 		log.Printf("Failed to save session: %v", err)
 	}
 
-	http.Redirect(w, r, "/terminal/", http.StatusSeeOther)
-}
+	if err := h.DB.RecordLogin(user.Email); err != nil {
+		log.Printf("Failed to update last login for %s: %v", user.Email, err)
+	}
+	if err := h.DB.RecordActivity(models.ActivityEvent{UserEmail: user.Email, Type: models.ActivityLogin}); err != nil {
+		log.Printf("Failed to record login for %s: %v", user.Email, err)
+	}
 
+	if returnTo == "" {
+		returnTo = "/terminal/"
+	}
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
 
 // HandleLogout clears the session and logs out the user
 func (h *AuthHandlers) HandleLogout(w http.ResponseWriter, r *http.Request) {
@@ -114,3 +184,40 @@ func (h *AuthHandlers) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	// Redirect to home page
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// HandleLogoutAll signs the user out of every device by revoking all of their
+// stored sessions (POST /logout/all)
+func (h *AuthHandlers) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, ok := currentEmail(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	revoked, err := h.DB.DeleteUserSessions(email)
+	if err != nil {
+		log.Printf("Error revoking sessions for %s: %v", email, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Signed %s out of %d session(s)", email, revoked)
+
+	// The current session's record is already gone; clear the cookie too
+	session, err := h.SessionStore.Get(r, "auth-session")
+	if err != nil {
+		log.Printf("Error getting session: %v", err)
+	}
+	session.Values = make(map[interface{}]interface{})
+	session.Options.MaxAge = -1
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session during logout: %v", err)
+	}
+
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/gorilla/sessions"
@@ -180,6 +181,95 @@ func TestOAuthFlowIntegration(t *testing.T) {
 	})
 }
 
+// TestHandleGoogleLoginStateAndPKCE verifies each login attempt gets a fresh
+// state bound to the session and a PKCE challenge
+func TestHandleGoogleLoginStateAndPKCE(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("test-key"))
+	handler := &AuthHandlers{
+		OAuthConfig: &oauth2.Config{
+			ClientID: "test-client-id",
+			Endpoint: oauth2.Endpoint{AuthURL: "https://accounts.google.com/o/oauth2/auth"},
+		},
+		SessionStore: store,
+		DB:           &database.MongoDB{},
+	}
+
+	login := func() (*url.URL, *http.Cookie) {
+		req := httptest.NewRequest(http.MethodGet, "/auth/google?return_to=/courses", nil)
+		w := httptest.NewRecorder()
+		handler.HandleGoogleLogin(w, req)
+
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Expected valid redirect URL: %v", err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) == 0 {
+			t.Fatal("Expected session cookie to be set")
+		}
+		return location, cookies[0]
+	}
+
+	first, cookie := login()
+	second, _ := login()
+
+	state := first.Query().Get("state")
+	if state == "" || state == "state-string" {
+		t.Errorf("Expected a random state, got %q", state)
+	}
+	if state == second.Query().Get("state") {
+		t.Error("Expected each login attempt to use a different state")
+	}
+	if first.Query().Get("code_challenge") == "" || first.Query().Get("code_challenge_method") != "S256" {
+		t.Error("Expected S256 PKCE challenge in redirect URL")
+	}
+
+	// The state must be stored in the session issued with the redirect
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	session, _ := store.Get(req, "auth-session")
+	if session.Values["oauth_state"] != state {
+		t.Error("Expected state to be stored in the session")
+	}
+	if session.Values["oauth_return_to"] != "/courses" {
+		t.Errorf("Expected return_to to be stored, got %v", session.Values["oauth_return_to"])
+	}
+}
+
+// TestHandleGoogleCallbackRejectsBadState verifies callbacks without the
+// session's state are refused before any code exchange
+func TestHandleGoogleCallbackRejectsBadState(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("test-key"))
+	handler := &AuthHandlers{
+		OAuthConfig:  &oauth2.Config{},
+		SessionStore: store,
+		DB:           &database.MongoDB{},
+	}
+
+	// No login attempt in progress
+	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?state=state-string&code=abc", nil)
+	w := httptest.NewRecorder()
+	handler.HandleGoogleCallback(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a stored state, got %d", w.Code)
+	}
+
+	// Login attempt in progress but state does not match
+	loginReq := httptest.NewRequest(http.MethodGet, "/auth/google", nil)
+	loginW := httptest.NewRecorder()
+	handler.HandleGoogleLogin(loginW, loginReq)
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/google/callback?state=forged&code=abc", nil)
+	for _, c := range loginW.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	handler.HandleGoogleCallback(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for mismatched state, got %d", w.Code)
+	}
+}
+
 // Helper function to check if string contains substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && 
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"supreme-broccoli/internal/database"
+	"supreme-broccoli/internal/helpers"
+	"supreme-broccoli/internal/models"
+)
+
+// HandleEnroll enrolls the current user in a course (POST /courses/{id}/enroll)
+func (h *PageHandlers) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	h.handleEnrollment(w, r, true)
+}
+
+// HandleUnenroll removes the current user from a course (POST /courses/{id}/unenroll)
+func (h *PageHandlers) HandleUnenroll(w http.ResponseWriter, r *http.Request) {
+	h.handleEnrollment(w, r, false)
+}
+
+// handleEnrollment applies an enroll or unenroll request for the course in the URL
+func (h *PageHandlers) handleEnrollment(w http.ResponseWriter, r *http.Request, enroll bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, ok := currentEmail(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	course, ok := h.loadCourse(w, r)
+	if !ok {
+		return
+	}
+
+	if enroll {
+		changed, err := h.DB.EnrollUser(email, course.ID)
+		if err != nil {
+			log.Printf("Error enrolling %s in %s: %v", email, course.ID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if changed {
+			h.recordActivity(email, models.ActivityEnrollment, course, "")
+		}
+		http.Redirect(w, r, "/terminal/course-detail/"+course.ID+"/content", http.StatusSeeOther)
+		return
+	}
+
+	changed, err := h.DB.UnenrollUser(email, course.ID)
+	if err != nil {
+		log.Printf("Error unenrolling %s from %s: %v", email, course.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if changed {
+		h.recordActivity(email, models.ActivityUnenrollment, course, "")
+	}
+	http.Redirect(w, r, "/courses", http.StatusSeeOther)
+}
+
+// HandleCompleteModule marks a course module's lab as done
+// (POST /courses/{id}/modules/{module}/complete)
+func (h *PageHandlers) HandleCompleteModule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, ok := currentEmail(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	course, ok := h.loadCourse(w, r)
+	if !ok {
+		return
+	}
+
+	module, err := strconv.Atoi(r.PathValue("module"))
+	if err != nil || module < 0 || module >= len(course.Modules) {
+		h.HandleNotFound(w, r)
+		return
+	}
+
+	progress, changed, err := h.DB.CompleteModule(email, course.ID, module, len(course.Modules))
+	if errors.Is(err, database.ErrNotFound) {
+		// Not enrolled; send them back to the course page to enroll
+		http.Redirect(w, r, "/terminal/course-detail/"+course.ID+"/content", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("Error completing module: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if changed {
+		h.recordActivity(email, models.ActivityLabCompletion, course, course.Modules[module].Title)
+		if progress.Progress == 100 {
+			h.recordActivity(email, models.ActivityCourseCompletion, course, "")
+		}
+	}
+
+	http.Redirect(w, r, "/terminal/course-detail/"+course.ID+"/content", http.StatusSeeOther)
+}
+
+// recordActivity stores a course-related activity event, logging any failure
+func (h *PageHandlers) recordActivity(email, eventType string, course models.Course, detail string) {
+	err := h.DB.RecordActivity(models.ActivityEvent{
+		UserEmail:   email,
+		Type:        eventType,
+		CourseID:    course.ID,
+		CourseTitle: course.Title,
+		Detail:      detail,
+	})
+	if err != nil {
+		log.Printf("Error recording activity: %v", err)
+	}
+}
+
+// HandleCourseDetail renders a course's content (GET /terminal/course-detail/{id}/content)
+func (h *PageHandlers) HandleCourseDetail(w http.ResponseWriter, r *http.Request) {
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "courses")
+
+	course, ok := h.loadCourse(w, r)
+	if !ok {
+		return
+	}
+
+	progress, err := h.DB.GetProgress(pageData.User.Email, course.ID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		log.Printf("Error loading progress for %s in %s: %v", pageData.User.Email, course.ID, err)
+	}
+
+	if progress.Enrolled {
+		if err := h.DB.TouchProgress(pageData.User.Email, course.ID); err != nil {
+			log.Printf("Error updating last access: %v", err)
+		}
+	}
+
+	completed := make(map[int]bool, len(progress.CompletedModules))
+	for _, m := range progress.CompletedModules {
+		completed[m] = true
+	}
+
+	detailData := helpers.CourseDetailPageData{
+		PageData: *pageData,
+		Course: helpers.CourseWithProgress{
+			Course:   course,
+			Progress: progress.Progress,
+			Enrolled: progress.Enrolled,
+		},
+		CompletedModules: completed,
+	}
+
+	err = h.templates.ExecuteTemplate(w, "course_detail.html", detailData)
+	if err != nil {
+		log.Printf("Error rendering course detail template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// loadCourse fetches the course named by the {id} path value, rendering a 404
+// page when it does not exist. It reports whether the caller should continue.
+func (h *PageHandlers) loadCourse(w http.ResponseWriter, r *http.Request) (models.Course, bool) {
+	course, err := h.DB.GetCourse(r.PathValue("id"))
+	if errors.Is(err, database.ErrNotFound) {
+		h.HandleNotFound(w, r)
+		return models.Course{}, false
+	}
+	if err != nil {
+		log.Printf("Error loading course: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return models.Course{}, false
+	}
+
+	return course, true
+}
+
+// HandleNotFound renders the 404 page
+func (h *PageHandlers) HandleNotFound(w http.ResponseWriter, r *http.Request) {
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "")
+
+	w.WriteHeader(http.StatusNotFound)
+	err := h.templates.ExecuteTemplate(w, "not_found.html", pageData)
+	if err != nil {
+		log.Printf("Error rendering not found template: %v", err)
+	}
+}
@@ -5,43 +5,70 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"supreme-broccoli/internal/auth"
+	"supreme-broccoli/internal/database"
 	"supreme-broccoli/internal/helpers"
+	"supreme-broccoli/internal/middleware"
 	"supreme-broccoli/internal/models"
+	"supreme-broccoli/internal/ratelimit"
 
 	"github.com/gorilla/sessions"
 )
 
+const (
+	// recentActivityLimit is the number of events shown in the profile activity feed
+	recentActivityLimit = 10
+
+	// contactRateLimit submissions are accepted per submitter in each contactRateWindow
+	contactRateLimit  = 5
+	contactRateWindow = time.Hour
+)
+
 // PageHandlers handles page rendering
 type PageHandlers struct {
-	SessionStore *sessions.CookieStore
-	templates    *template.Template
+	SessionStore   sessions.Store
+	DB             *database.MongoDB
+	Users          *middleware.UserCache
+	templates      *template.Template
+	contactLimiter *ratelimit.Limiter
 }
 
 // NewPageHandlers creates a new PageHandlers instance
-func NewPageHandlers(sessionStore *sessions.CookieStore) *PageHandlers {
+func NewPageHandlers(sessionStore sessions.Store, db *database.MongoDB, users *middleware.UserCache) *PageHandlers {
+	return &PageHandlers{
+		SessionStore:   sessionStore,
+		DB:             db,
+		Users:          users,
+		templates:      parseTemplates(),
+		contactLimiter: ratelimit.New(contactRateLimit, contactRateWindow),
+	}
+}
+
+// parseTemplates parses all page templates along with their partials
+func parseTemplates() *template.Template {
 	// Parse all templates
 	templates, err := template.ParseGlob("templates/*.html")
 	if err != nil {
 		log.Printf("Warning: Failed to parse templates: %v", err)
+		templates = template.New("")
 	}
-	
+
 	// Parse partials
 	templates, err = templates.ParseGlob("templates/partials/*.html")
 	if err != nil {
 		log.Printf("Warning: Failed to parse partial templates: %v", err)
 	}
 
-	return &PageHandlers{
-		SessionStore: sessionStore,
-		templates:    templates,
-	}
+	return templates
 }
 
 // HandleHome renders the home page
 func (h *PageHandlers) HandleHome(w http.ResponseWriter, r *http.Request) {
 	// Get page data from session
-	pageData := helpers.GetPageData(r, h.SessionStore, "home")
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "home")
 
 	// Render the home template
 	err := h.templates.ExecuteTemplate(w, "home.html", pageData)
@@ -55,10 +82,23 @@ func (h *PageHandlers) HandleHome(w http.ResponseWriter, r *http.Request) {
 // HandleCourses renders the courses page with available courses
 func (h *PageHandlers) HandleCourses(w http.ResponseWriter, r *http.Request) {
 	// Get page data from session
-	pageData := helpers.GetPageData(r, h.SessionStore, "courses")
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "courses")
+
+	// Fetch the catalog and the user's progress
+	catalog, err := h.DB.ListCourses()
+	if err != nil {
+		log.Printf("Error loading courses: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
-	// Fetch mock courses with progress
-	courses := helpers.GetCoursesWithProgress(pageData.User)
+	progress, err := h.DB.GetUserProgress(pageData.User.Email)
+	if err != nil {
+		// Still show the catalog, just without progress
+		log.Printf("Error loading progress for %s: %v", pageData.User.Email, err)
+	}
+
+	courses := helpers.GetCoursesWithProgress(catalog, progress)
 
 	// Create courses page data
 	coursesData := helpers.CoursesPageData{
@@ -67,7 +107,7 @@ func (h *PageHandlers) HandleCourses(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Render the courses template
-	err := h.templates.ExecuteTemplate(w, "courses.html", coursesData)
+	err = h.templates.ExecuteTemplate(w, "courses.html", coursesData)
 	if err != nil {
 		log.Printf("Error rendering courses template: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -75,18 +115,27 @@ func (h *PageHandlers) HandleCourses(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-
 // HandleProfile renders the user profile page
 func (h *PageHandlers) HandleProfile(w http.ResponseWriter, r *http.Request) {
 	// Get page data from session
-	pageData := helpers.GetPageData(r, h.SessionStore, "profile")
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "profile")
+
+	// Aggregate statistics and recent activity from stored events
+	summary, err := h.DB.GetActivitySummary(pageData.User.Email)
+	if err != nil {
+		log.Printf("Error loading activity summary for %s: %v", pageData.User.Email, err)
+	}
 
-	// Get profile data with statistics and activity
-	profileData := helpers.GetProfileData(pageData.User)
+	events, err := h.DB.GetRecentActivity(pageData.User.Email, recentActivityLimit)
+	if err != nil {
+		log.Printf("Error loading recent activity for %s: %v", pageData.User.Email, err)
+	}
+
+	profileData := helpers.GetProfileData(summary, events, time.Now())
 	profileData.PageData = *pageData
 
 	// Render the profile template
-	err := h.templates.ExecuteTemplate(w, "profile.html", profileData)
+	err = h.templates.ExecuteTemplate(w, "profile.html", profileData)
 	if err != nil {
 		log.Printf("Error rendering profile template: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -94,21 +143,22 @@ func (h *PageHandlers) HandleProfile(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-
 // HandleSettingsPage renders the settings page (GET)
 func (h *PageHandlers) HandleSettingsPage(w http.ResponseWriter, r *http.Request) {
 	// Get page data from session
-	pageData := helpers.GetPageData(r, h.SessionStore, "settings")
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "settings")
 
 	// Get success/error messages from session if any
 	session, _ := h.SessionStore.Get(r, "auth-session")
 	successMsg, _ := session.Values["success_message"].(string)
 	errorMsg, _ := session.Values["error_message"].(string)
 	
-	// Clear messages from session
-	delete(session.Values, "success_message")
-	delete(session.Values, "error_message")
-	session.Save(r, w)
+	// Clear messages from session, saving only when there was one to clear
+	if successMsg != "" || errorMsg != "" {
+		delete(session.Values, "success_message")
+		delete(session.Values, "error_message")
+		session.Save(r, w)
+	}
 
 	// Get user settings (use defaults if not set)
 	settings := pageData.User.Settings
@@ -116,16 +166,24 @@ func (h *PageHandlers) HandleSettingsPage(w http.ResponseWriter, r *http.Request
 		settings = models.DefaultSettings()
 	}
 
+	// Signed-in devices, for the "sign out all devices" section
+	devices, err := h.DB.ListUserSessions(pageData.User.Email)
+	if err != nil {
+		log.Printf("Error loading sessions for %s: %v", pageData.User.Email, err)
+	}
+
 	// Create settings page data
 	settingsData := helpers.SettingsPageData{
-		PageData:       *pageData,
-		Settings:       settings,
-		SuccessMessage: successMsg,
-		ErrorMessage:   errorMsg,
+		PageData:         *pageData,
+		Settings:         settings,
+		Sessions:         devices,
+		CurrentSessionID: session.ID,
+		SuccessMessage:   successMsg,
+		ErrorMessage:     errorMsg,
 	}
 
 	// Render the settings template
-	err := h.templates.ExecuteTemplate(w, "settings.html", settingsData)
+	err = h.templates.ExecuteTemplate(w, "settings.html", settingsData)
 	if err != nil {
 		log.Printf("Error rendering settings template: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -144,26 +202,29 @@ func (h *PageHandlers) HandleSettingsUpdate(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Get current user from session
-	session, _ := h.SessionStore.Get(r, "auth-session")
-	email, ok := session.Values["email"].(string)
-	if !ok || email == "" {
+	// Get current user from the auth middleware
+	email, ok := currentEmail(r)
+	if !ok {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
 	// Parse and validate settings
-	_, validationErr := h.parseAndValidateSettings(r)
+	settings, validationErr := h.parseAndValidateSettings(r)
 	if validationErr != "" {
 		h.setSessionMessage(r, w, "", validationErr)
 		http.Redirect(w, r, "/settings", http.StatusSeeOther)
 		return
 	}
 
-	// TODO: Update settings in database
-	// For now, we'll just show a success message
-	// In a real implementation, you would call a database function here
-	// settings would be used here: db.UpdateUserSettings(email, settings)
+	// Persist settings
+	if err := h.DB.UpdateUserSettings(email, settings); err != nil {
+		log.Printf("Failed to save settings for %s: %v", email, err)
+		h.setSessionMessage(r, w, "", "Failed to save settings. Please try again.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+	h.Users.Invalidate(email)
 
 	h.setSessionMessage(r, w, "Settings saved successfully!", "")
 	http.Redirect(w, r, "/settings", http.StatusSeeOther)
@@ -221,11 +282,10 @@ func (h *PageHandlers) setSessionMessage(r *http.Request, w http.ResponseWriter,
 	session.Save(r, w)
 }
 
-
 // HandleAbout renders the about page
 func (h *PageHandlers) HandleAbout(w http.ResponseWriter, r *http.Request) {
 	// Get page data from session
-	pageData := helpers.GetPageData(r, h.SessionStore, "about")
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "about")
 
 	// Render the about template
 	err := h.templates.ExecuteTemplate(w, "about.html", pageData)
@@ -236,21 +296,22 @@ func (h *PageHandlers) HandleAbout(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-
 // HandleContactPage renders the contact page (GET)
 func (h *PageHandlers) HandleContactPage(w http.ResponseWriter, r *http.Request) {
 	// Get page data from session
-	pageData := helpers.GetPageData(r, h.SessionStore, "contact")
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "contact")
 
 	// Get success/error messages from session if any
 	session, _ := h.SessionStore.Get(r, "auth-session")
 	successMsg, _ := session.Values["success_message"].(string)
 	errorMsg, _ := session.Values["error_message"].(string)
 	
-	// Clear messages from session
-	delete(session.Values, "success_message")
-	delete(session.Values, "error_message")
-	session.Save(r, w)
+	// Clear messages from session, saving only when there was one to clear
+	if successMsg != "" || errorMsg != "" {
+		delete(session.Values, "success_message")
+		delete(session.Values, "error_message")
+		session.Save(r, w)
+	}
 
 	// Create contact page data
 	contactData := helpers.ContactPageData{
@@ -270,8 +331,22 @@ func (h *PageHandlers) HandleContactPage(w http.ResponseWriter, r *http.Request)
 
 // HandleContactSubmit processes contact form submission (POST)
 func (h *PageHandlers) HandleContactSubmit(w http.ResponseWriter, r *http.Request) {
-	// Parse form data
+	// Limit submissions per client address and per sender address before
+	// anything is written to the session, so rejected clients cannot create
+	// sessions in a loop
 	err := r.ParseForm()
+	email := r.FormValue("email")
+	ip := auth.ClientIP(r)
+	keys := []string{"ip:" + ip}
+	if email != "" {
+		keys = append(keys, "email:"+strings.ToLower(email))
+	}
+	if !h.contactLimiter.AllowAll(keys...) {
+		log.Printf("Contact form rate limit exceeded - IP: %s, Email: %s", ip, email)
+		http.Error(w, "You've sent several messages recently. Please try again later.", http.StatusTooManyRequests)
+		return
+	}
+
 	if err != nil {
 		log.Printf("Error parsing form: %v", err)
 		h.setSessionMessage(r, w, "", "Invalid form data")
@@ -281,7 +356,6 @@ func (h *PageHandlers) HandleContactSubmit(w http.ResponseWriter, r *http.Reques
 
 	// Get form values
 	name := r.FormValue("name")
-	email := r.FormValue("email")
 	subject := r.FormValue("subject")
 	message := r.FormValue("message")
 
@@ -292,9 +366,19 @@ func (h *PageHandlers) HandleContactSubmit(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// TODO: Save contact message to database
-	// For now, we'll just log it and show a success message
-	log.Printf("Contact form submission - Name: %s, Email: %s, Subject: %s", name, email, subject)
+	msg := models.ContactMessage{
+		Name:      name,
+		Email:     email,
+		Subject:   subject,
+		Message:   message,
+		IPAddress: ip,
+	}
+	if err := h.DB.SaveContactMessage(msg); err != nil {
+		log.Printf("Error saving contact message: %v", err)
+		h.setSessionMessage(r, w, "", "We couldn't send your message. Please try again.")
+		http.Redirect(w, r, "/contact", http.StatusSeeOther)
+		return
+	}
 
 	h.setSessionMessage(r, w, "Thank you for contacting us! We'll get back to you soon.", "")
 	http.Redirect(w, r, "/contact", http.StatusSeeOther)
@@ -358,3 +442,12 @@ func (h *PageHandlers) isValidEmail(email string) bool {
 	
 	return atIndex > 0 && dotIndex > atIndex+1 && dotIndex < len(email)-1
 }
+
+// currentEmail returns the email of the user resolved by the auth middleware
+func currentEmail(r *http.Request) (string, bool) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok || user.Email == "" {
+		return "", false
+	}
+	return user.Email, true
+}
@@ -1,49 +1,282 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"supreme-broccoli/internal/database"
+	"supreme-broccoli/internal/helpers"
+	"supreme-broccoli/internal/terminal"
 )
 
-// HandleEditorProxy proxies requests to Theia IDE
-func HandleEditorProxy(w http.ResponseWriter, r *http.Request) {
-	targetURL, err := url.Parse("http://localhost:9090")
-	if err != nil {
-		log.Printf("Failed to parse target URL: %v", err)
-		http.Error(w, "Error parsing proxy URL", http.StatusInternalServerError)
+// editorPrefix is where the editor is mounted; the editor itself is served
+// from the root of its port
+const editorPrefix = "/editor"
+
+// proxyTarget is where a proxied request goes. Servers behind the proxy are
+// served from the root of their port and mounted at prefix on this site.
+type proxyTarget struct {
+	url    *url.URL
+	prefix string
+	// preview is the port previewed in the session's environment; zero for
+	// the editor
+	preview int
+}
+
+// proxyTargetKey carries the proxyTarget for a request from the handler to
+// the proxy's Rewrite
+type proxyTargetKey struct{}
+
+// EditorHandlers proxies each user to the Theia IDE, and to the lab apps
+// previewed, forwarded by their own terminal session
+type EditorHandlers struct {
+	SessionStore sessions.Store
+	DB           *database.MongoDB
+	Sessions     *terminal.Manager
+	// PreviewPorts are the ports in a session's environment that may be
+	// previewed
+	PreviewPorts []int
+	templates    *template.Template
+	proxy        *httputil.ReverseProxy
+}
+
+// NewEditorHandlers creates a new EditorHandlers instance
+func NewEditorHandlers(sessionStore sessions.Store, db *database.MongoDB, registry *terminal.Manager, previewPorts []int) *EditorHandlers {
+	h := &EditorHandlers{
+		SessionStore: sessionStore,
+		DB:           db,
+		Sessions:     registry,
+		PreviewPorts: previewPorts,
+		templates:    parseTemplates(),
+	}
+	h.proxy = &httputil.ReverseProxy{
+		Rewrite:        rewriteProxyRequest,
+		Transport:      newProxyTransport(),
+		FlushInterval:  -1, // flush every write so streamed responses aren't held back
+		ModifyResponse: rewriteProxyResponse,
+		ErrorHandler:   h.handleProxyError,
+	}
+	return h
+}
+
+// newProxyTransport creates the transport shared by every proxied request.
+// Forwards are on local ports, so connections are quick to make and are kept
+// open for the many small requests an IDE issues.
+func newProxyTransport() *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          256,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// HandleEditorProxy proxies requests to the Theia IDE on the local port
+// forwarded by the user's terminal session. Users without a running session
+// that forwards an editor get an error page instead. WebSocket upgrades are
+// passed through to the editor.
+func (h *EditorHandlers) HandleEditorProxy(w http.ResponseWriter, r *http.Request) {
+	email, _ := currentEmail(r)
+	port, ok := h.Sessions.EditorPort(email)
+	if !ok {
+		h.renderUnavailable(w, r)
 		return
 	}
 
-	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	h.serveProxy(w, r, &proxyTarget{url: localURL(port), prefix: editorPrefix})
+}
+
+// HandlePreviewProxy proxies /preview/{port}/ to a web app the user runs on
+// that port in their terminal session's environment, through the session's
+// own forward. Only the configured preview ports may be reached.
+func (h *EditorHandlers) HandlePreviewProxy(w http.ResponseWriter, r *http.Request) {
+	remote, err := strconv.Atoi(r.PathValue("port"))
+	if err != nil || !slices.Contains(h.PreviewPorts, remote) {
+		http.Error(w, "Port not available for preview", http.StatusNotFound)
+		return
+	}
+
+	email, _ := currentEmail(r)
+	port, ok := h.Sessions.PreviewPort(email, remote)
+	if !ok {
+		h.renderPreviewUnavailable(w, r, remote, false)
+		return
+	}
+
+	// Serve the app from its root, as StripPrefix does for the editor
+	prefix := "/preview/" + strconv.Itoa(remote)
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+
+	h.serveProxy(w, r2, &proxyTarget{url: localURL(port), prefix: prefix, preview: remote})
+}
+
+// serveProxy proxies a request to target
+func (h *EditorHandlers) serveProxy(w http.ResponseWriter, r *http.Request, target *proxyTarget) {
+	h.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyTargetKey{}, target)))
+}
+
+// localURL is the URL of a forwarded port on this server
+func localURL(port int) *url.URL {
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort("localhost", strconv.Itoa(port))}
+}
+
+// rewriteProxyRequest points a request at its target. Hop-by-hop headers
+// have already been removed; the proxy restores the upgrade headers itself
+// for WebSocket requests. The app's session cookie is dropped, since
+// anything listening on a forwarded port, including servers users start in
+// their labs, would otherwise receive it.
+func rewriteProxyRequest(pr *httputil.ProxyRequest) {
+	target := pr.In.Context().Value(proxyTargetKey{}).(*proxyTarget)
+	pr.SetURL(target.url)
+
+	// The prefix has already been stripped, possibly along with the slash
+	pr.Out.URL.Path = "/" + strings.TrimPrefix(pr.In.URL.Path, "/")
+	if pr.In.URL.RawPath != "" {
+		pr.Out.URL.RawPath = "/" + strings.TrimPrefix(pr.In.URL.RawPath, "/")
+	}
+
+	pr.SetXForwarded()
+	pr.Out.Header.Set("X-Forwarded-Prefix", target.prefix)
+
+	cookies := pr.Out.Cookies()
+	pr.Out.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != "auth-session" {
+			pr.Out.AddCookie(cookie)
+		}
+	}
+}
+
+// rewriteProxyResponse maps redirects and cookies from the target's root
+// onto its prefix
+func rewriteProxyResponse(res *http.Response) error {
+	target := res.Request.Context().Value(proxyTargetKey{}).(*proxyTarget)
 
-	proxy.Director = func(req *http.Request) {
-		req.URL.Scheme = targetURL.Scheme
-		req.URL.Host = targetURL.Host
-		req.URL.Path = r.URL.Path
-		req.Host = targetURL.Host
+	if loc := res.Header.Get("Location"); loc != "" {
+		res.Header.Set("Location", rewriteProxyLocation(loc, res.Request.URL.Host, target.prefix))
+	}
 
-		// Handle WebSocket upgrade headers
-		if r.Header.Get("Connection") == "Upgrade" && r.Header.Get("Upgrade") == "websocket" {
-			log.Println("Proxying WebSocket upgrade request to Theia")
-			req.Header.Set("Connection", "Upgrade")
-			req.Header.Set("Upgrade", "websocket")
+	if cookies := res.Header.Values("Set-Cookie"); len(cookies) > 0 {
+		res.Header.Del("Set-Cookie")
+		for _, line := range cookies {
+			res.Header.Add("Set-Cookie", rewriteProxyCookie(line, target.prefix))
 		}
 	}
+	return nil
+}
 
-	proxy.ModifyResponse = func(res *http.Response) error {
-		if loc, ok := res.Header["Location"]; ok && len(loc) > 0 {
-			if strings.HasPrefix(loc[0], targetURL.String()) {
-				res.Header.Set("Location", strings.Replace(loc[0], targetURL.String(), "/editor", 1))
-			} else if strings.HasPrefix(loc[0], "/") {
-				res.Header.Set("Location", "/editor"+loc[0])
-			}
+// rewriteProxyLocation maps a redirect to the target's host onto prefix.
+// Links to other sites are left alone.
+func rewriteProxyLocation(loc, targetHost, prefix string) string {
+	u, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+	if u.IsAbs() {
+		if u.Host != targetHost {
+			return loc
 		}
-		return nil
+		u.Scheme, u.Host = "", ""
+	} else if !strings.HasPrefix(u.Path, "/") {
+		// Relative redirects already resolve under the prefix
+		return loc
+	}
+	u.Path = prefix + u.Path
+	if u.RawPath != "" {
+		u.RawPath = prefix + u.RawPath
+	}
+	return u.String()
+}
+
+// rewriteProxyCookie scopes a cookie set behind the proxy to prefix on our
+// own host, so it neither leaks to the rest of the site nor names the
+// target's local host
+func rewriteProxyCookie(line, prefix string) string {
+	cookie, err := http.ParseSetCookie(line)
+	if err != nil {
+		return line
+	}
+	cookie.Domain = ""
+	if cookie.Path == "" || cookie.Path == "/" {
+		cookie.Path = prefix + "/"
+	} else if strings.HasPrefix(cookie.Path, "/") {
+		cookie.Path = prefix + cookie.Path
+	}
+	return cookie.String()
+}
+
+// handleProxyError renders an error page when the editor or a previewed app
+// can't be reached, such as while it is still starting
+func (h *EditorHandlers) handleProxyError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		// The browser went away; there is no one to show a page to
+		return
 	}
+	target := r.Context().Value(proxyTargetKey{}).(*proxyTarget)
+	log.Printf("Proxy error for %s%s: %v", target.prefix, r.URL.Path, err)
 
-	log.Printf("Proxying editor request for: %s", r.URL.Path)
-	proxy.ServeHTTP(w, r)
+	if target.preview != 0 {
+		h.renderPreviewUnavailable(w, r, target.preview, true)
+		return
+	}
+
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "terminal")
+
+	w.WriteHeader(http.StatusBadGateway)
+	err = h.templates.ExecuteTemplate(w, "editor_error.html", pageData)
+	if err != nil {
+		log.Printf("Error rendering editor error template: %v", err)
+	}
+}
+
+// renderUnavailable explains that the editor needs a running terminal session
+func (h *EditorHandlers) renderUnavailable(w http.ResponseWriter, r *http.Request) {
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "terminal")
+
+	w.WriteHeader(http.StatusServiceUnavailable)
+	err := h.templates.ExecuteTemplate(w, "editor_unavailable.html", pageData)
+	if err != nil {
+		log.Printf("Error rendering editor unavailable template: %v", err)
+	}
+}
+
+// renderPreviewUnavailable explains why a preview can't be shown: there is no
+// session forwarding the port, or nothing answered on it
+func (h *EditorHandlers) renderPreviewUnavailable(w http.ResponseWriter, r *http.Request, port int, running bool) {
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "terminal")
+
+	status := http.StatusServiceUnavailable
+	if running {
+		status = http.StatusBadGateway
+	}
+	w.WriteHeader(status)
+	err := h.templates.ExecuteTemplate(w, "preview_unavailable.html", helpers.PreviewPageData{
+		PageData:       *pageData,
+		Port:           port,
+		SessionRunning: running,
+	})
+	if err != nil {
+		log.Printf("Error rendering preview unavailable template: %v", err)
+	}
 }
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"supreme-broccoli/internal/middleware"
+	"supreme-broccoli/internal/models"
+	"supreme-broccoli/internal/terminal"
+)
+
+// newTestEditorProxy serves the proxy under /editor/ in front of the given
+// editor
+func newTestEditorProxy(t *testing.T, editor *httptest.Server) *httptest.Server {
+	t.Helper()
+	target, err := url.Parse(editor.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse editor URL: %v", err)
+	}
+	proxy := &httputil.ReverseProxy{
+		Rewrite:        rewriteProxyRequest,
+		Transport:      newProxyTransport(),
+		FlushInterval:  -1,
+		ModifyResponse: rewriteProxyResponse,
+	}
+	handler := http.StripPrefix("/editor/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyTargetKey{}, &proxyTarget{url: target, prefix: editorPrefix})))
+	}))
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestEditorProxyRewrites verifies paths, forwarding headers, redirects and
+// cookies are mapped between /editor/ and the editor's root
+func TestEditorProxyRewrites(t *testing.T) {
+	var got *http.Request
+	editor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		http.SetCookie(w, &http.Cookie{Name: "theia", Value: "1", Path: "/", Domain: "localhost"})
+		http.SetCookie(w, &http.Cookie{Name: "ws", Value: "2", Path: "/services"})
+		http.Redirect(w, r, "http://"+r.Host+"/workspace?folder=%2Fhome", http.StatusFound)
+	}))
+	defer editor.Close()
+	server := newTestEditorProxy(t, editor)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	req, _ := http.NewRequest("GET", server.URL+"/editor/files/a%2Fb?x=1", nil)
+	req.AddCookie(&http.Cookie{Name: "auth-session", Value: "secret"})
+	req.AddCookie(&http.Cookie{Name: "theia", Value: "1"})
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if got.URL.EscapedPath() != "/files/a%2Fb" || got.URL.RawQuery != "x=1" {
+		t.Errorf("Expected editor to get /files/a%%2Fb?x=1, got %s", got.URL.RequestURI())
+	}
+	if got.Header.Get("X-Forwarded-Host") != strings.TrimPrefix(server.URL, "http://") {
+		t.Errorf("Unexpected X-Forwarded-Host %q", got.Header.Get("X-Forwarded-Host"))
+	}
+	if got.Header.Get("X-Forwarded-Proto") != "http" || got.Header.Get("X-Forwarded-For") == "" {
+		t.Errorf("Missing X-Forwarded headers: %v", got.Header)
+	}
+	if got.Header.Get("X-Forwarded-Prefix") != "/editor" {
+		t.Errorf("Expected X-Forwarded-Prefix /editor, got %q", got.Header.Get("X-Forwarded-Prefix"))
+	}
+	if _, err := got.Cookie("auth-session"); err == nil {
+		t.Error("Expected the session cookie not to reach the editor")
+	}
+	if c, err := got.Cookie("theia"); err != nil || c.Value != "1" {
+		t.Errorf("Expected the editor's own cookie to be forwarded, got %q", got.Header.Get("Cookie"))
+	}
+
+	if loc := resp.Header.Get("Location"); loc != "/editor/workspace?folder=%2Fhome" {
+		t.Errorf("Expected redirect to /editor/workspace, got %q", loc)
+	}
+	cookies := resp.Header.Values("Set-Cookie")
+	if len(cookies) != 2 || cookies[0] != "theia=1; Path=/editor/" || cookies[1] != "ws=2; Path=/editor/services" {
+		t.Errorf("Unexpected cookies %q", cookies)
+	}
+}
+
+// TestEditorProxyWebSocket verifies WebSocket upgrades pass through the proxy
+func TestEditorProxyWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	editor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services" {
+			http.NotFound(w, r)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			kind, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(kind, data)
+		}
+	}))
+	defer editor.Close()
+	server := newTestEditorProxy(t, editor)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/editor/services", nil)
+	if err != nil {
+		t.Fatalf("WebSocket dial through proxy failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	_, data, err := conn.ReadMessage()
+	if err != nil || string(data) != "ping" {
+		t.Errorf("Expected echo of ping, got %q (%v)", data, err)
+	}
+}
+
+// TestRewriteProxyLocation verifies only redirects to the target are mapped
+func TestRewriteProxyLocation(t *testing.T) {
+	tests := []struct {
+		loc, want string
+	}{
+		{"/login", "/editor/login"},
+		{"http://localhost:9100/a?b=c", "/editor/a?b=c"},
+		{"https://accounts.google.com/o/oauth2", "https://accounts.google.com/o/oauth2"},
+		{"next", "next"},
+	}
+	for _, tt := range tests {
+		if got := rewriteProxyLocation(tt.loc, "localhost:9100", editorPrefix); got != tt.want {
+			t.Errorf("rewriteProxyLocation(%q) = %q, want %q", tt.loc, got, tt.want)
+		}
+	}
+}
+
+// TestHandlePreviewProxy verifies previews reach only allowed ports forwarded
+// by the user's own session, with the /preview/{port} prefix mapped
+func TestHandlePreviewProxy(t *testing.T) {
+	var got *http.Request
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}))
+	defer app.Close()
+	appURL, _ := url.Parse(app.URL)
+	appPort, _ := strconv.Atoi(appURL.Port())
+
+	registry := terminal.NewManager(time.Minute, 1024, terminal.Limits{})
+	cmd, _ := (&terminal.LocalShellBackend{Shell: "/bin/sh"}).Command(terminal.Launch{})
+	live, err := registry.Start(terminal.Session{
+		ID:           "s1",
+		UserEmail:    "a@example.com",
+		PreviewPorts: map[int]int{8000: appPort},
+		StartedAt:    time.Now(),
+	}, cmd, terminal.StartOptions{})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer live.Close()
+
+	h := &EditorHandlers{Sessions: registry, PreviewPorts: []int{8000, 3000}}
+	h.proxy = &httputil.ReverseProxy{
+		Rewrite:        rewriteProxyRequest,
+		Transport:      newProxyTransport(),
+		ModifyResponse: rewriteProxyResponse,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/preview/{port}/{path...}", h.HandlePreviewProxy)
+
+	serve := func(email, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req = req.WithContext(middleware.WithUser(req.Context(), &models.User{Email: email}))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("a@example.com", "/preview/8000/api/items?page=2")
+	if rec.Code != http.StatusFound || got == nil {
+		t.Fatalf("Expected the app's redirect, got %d", rec.Code)
+	}
+	if got.URL.RequestURI() != "/api/items?page=2" {
+		t.Errorf("Expected app to get /api/items?page=2, got %s", got.URL.RequestURI())
+	}
+	if got.Header.Get("X-Forwarded-Prefix") != "/preview/8000" {
+		t.Errorf("Expected X-Forwarded-Prefix /preview/8000, got %q", got.Header.Get("X-Forwarded-Prefix"))
+	}
+	if loc := rec.Header().Get("Location"); loc != "/preview/8000/login" {
+		t.Errorf("Expected redirect to /preview/8000/login, got %q", loc)
+	}
+
+	if rec := serve("a@example.com", "/preview/22/"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a port outside the allowlist to be refused, got %d", rec.Code)
+	}
+}
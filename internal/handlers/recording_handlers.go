@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+
+	"supreme-broccoli/internal/database"
+	"supreme-broccoli/internal/helpers"
+	"supreme-broccoli/internal/middleware"
+	"supreme-broccoli/internal/models"
+	"supreme-broccoli/internal/recording"
+)
+
+// RecordingHandlers serves terminal session recordings to their owners and
+// to admins
+type RecordingHandlers struct {
+	SessionStore sessions.Store
+	DB           *database.MongoDB
+	Recordings   *recording.Store
+	templates    *template.Template
+}
+
+// NewRecordingHandlers creates a new RecordingHandlers instance
+func NewRecordingHandlers(sessionStore sessions.Store, db *database.MongoDB, recordings *recording.Store) *RecordingHandlers {
+	return &RecordingHandlers{
+		SessionStore: sessionStore,
+		DB:           db,
+		Recordings:   recordings,
+		templates:    parseTemplates(),
+	}
+}
+
+// HandleRecording renders the playback page for a recording (GET /recordings/{id})
+func (h *RecordingHandlers) HandleRecording(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.loadRecording(w, r)
+	if !ok {
+		return
+	}
+
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "terminal")
+	err := h.templates.ExecuteTemplate(w, "recording.html", helpers.RecordingPageData{
+		PageData:  *pageData,
+		Recording: rec,
+	})
+	if err != nil {
+		log.Printf("Error rendering recording template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// HandleRecordingCast serves the asciicast file for the player (GET /recordings/{id}/cast)
+func (h *RecordingHandlers) HandleRecordingCast(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.loadRecording(w, r)
+	if !ok {
+		return
+	}
+	h.serveCast(w, r, rec, false)
+}
+
+// HandleDownloadRecording serves a recording as a file download
+// (GET /admin/recordings/{id}/download)
+func (h *RecordingHandlers) HandleDownloadRecording(w http.ResponseWriter, r *http.Request) {
+	rec, ok := h.loadRecording(w, r)
+	if !ok {
+		return
+	}
+	h.serveCast(w, r, rec, true)
+}
+
+// loadRecording looks up the recording named in the path and checks that the
+// current user may view it. It writes the error response when it returns false.
+func (h *RecordingHandlers) loadRecording(w http.ResponseWriter, r *http.Request) (models.Recording, bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return models.Recording{}, false
+	}
+
+	rec, err := h.DB.GetRecording(r.PathValue("id"))
+	if errors.Is(err, database.ErrNotFound) {
+		http.NotFound(w, r)
+		return models.Recording{}, false
+	}
+	if err != nil {
+		log.Printf("Error loading recording %s: %v", r.PathValue("id"), err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return models.Recording{}, false
+	}
+
+	// Other users' recordings are reported as missing rather than forbidden
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok || (user.Email != rec.UserEmail && user.Role != models.RoleAdmin) {
+		http.NotFound(w, r)
+		return models.Recording{}, false
+	}
+	return rec, true
+}
+
+// serveCast writes a recording file, as an attachment when download is set
+func (h *RecordingHandlers) serveCast(w http.ResponseWriter, r *http.Request, rec models.Recording, download bool) {
+	f, err := h.Recordings.Open(rec.Path)
+	if err != nil {
+		log.Printf("Error opening recording %s: %v", rec.ID, err)
+		http.Error(w, "Recording unavailable", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("Error reading recording %s: %v", rec.ID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	if download {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+rec.ID+`.cast"`)
+	}
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
@@ -2,47 +2,137 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
 	"log"
 	"net/http"
-	"os"
-	"os/exec"
 	"time"
 
-	"github.com/creack/pty"
 	"github.com/gorilla/sessions"
 	"github.com/gorilla/websocket"
 	"golang.org/x/oauth2"
 
+	"supreme-broccoli/internal/audit"
+	"supreme-broccoli/internal/auth"
 	"supreme-broccoli/internal/database"
+	"supreme-broccoli/internal/helpers"
+	"supreme-broccoli/internal/middleware"
+	"supreme-broccoli/internal/models"
+	"supreme-broccoli/internal/recording"
+	"supreme-broccoli/internal/terminal"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
-}
+// errRecordingFailed is reported to clients whose session must be recorded
+// when the recording could not be created
+var errRecordingFailed = errors.New("failed to start session recording")
 
 type TerminalHandlers struct {
 	OAuthConfig  *oauth2.Config
-	SessionStore *sessions.CookieStore
+	SessionStore sessions.Store
 	DB           *database.MongoDB
+	Sessions     *terminal.Manager
+	Backends     *terminal.Backends
+	Recordings   *recording.Store
+	// EditorPorts supplies the local ports editors and previews are
+	// forwarded to
+	EditorPorts *terminal.PortPool
+	// CommandAudit, when set, records the commands run in each session
+	CommandAudit *audit.Policy
+	// TransferLimit is the largest file that may be uploaded into or
+	// downloaded from a session
+	TransferLimit int64
+	// Tickets authorize WebSocket handshakes; checkOrigin rejects handshakes
+	// from other sites
+	Tickets     *auth.TicketStore
+	checkOrigin func(*http.Request) bool
+	upgrader    websocket.Upgrader
+	templates   *template.Template
+}
+
+// NewTerminalHandlers creates a new TerminalHandlers instance
+func NewTerminalHandlers(oauthConfig *oauth2.Config, sessionStore sessions.Store, db *database.MongoDB, registry *terminal.Manager, backends *terminal.Backends, editorPorts *terminal.PortPool, recordings *recording.Store, commandAudit *audit.Policy, transferLimit int64, tickets *auth.TicketStore, checkOrigin func(*http.Request) bool) *TerminalHandlers {
+	return &TerminalHandlers{
+		OAuthConfig:   oauthConfig,
+		SessionStore:  sessionStore,
+		DB:            db,
+		Sessions:      registry,
+		Backends:      backends,
+		EditorPorts:   editorPorts,
+		Recordings:    recordings,
+		CommandAudit:  commandAudit,
+		TransferLimit: transferLimit,
+		Tickets:       tickets,
+		checkOrigin:   checkOrigin,
+		// The write buffer fits a whole batch of terminal output in one frame
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  4096,
+			WriteBufferSize: 32 * 1024,
+			CheckOrigin:     checkOrigin,
+		},
+		templates: parseTemplates(),
+	}
 }
 
-// HandleTerminal serves the terminal page
+// HandleTerminal serves the terminal page with the user's saved preferences
 func (h *TerminalHandlers) HandleTerminal(w http.ResponseWriter, r *http.Request) {
-	session, _ := h.SessionStore.Get(r, "auth-session")
-	email, ok := session.Values["email"].(string)
-	if !ok || email == "" {
+	pageData := helpers.GetPageData(r, h.SessionStore, h.DB, "terminal")
+	if !pageData.IsAuthenticated {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
-	http.ServeFile(w, r, "index.html")
+
+	query := r.URL.Query()
+	terminalData := helpers.TerminalPageData{
+		PageData:   *pageData,
+		Settings:   pageData.User.Settings,
+		CourseID:   query.Get("course"),
+		ShareToken: query.Get("share"),
+		WatchID:    query.Get("watch"),
+		Access:     query.Get("access"),
+		Ticket:     h.Tickets.Issue(pageData.User.Email),
+	}
+
+	err := h.templates.ExecuteTemplate(w, "terminal.html", terminalData)
+	if err != nil {
+		log.Printf("Error rendering terminal template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 }
 
-// HandleWebSocket manages WebSocket connections for the terminal
+// HandleTicket issues a fresh WebSocket ticket for the terminal page to
+// reconnect with (POST /terminal/ticket). Other sites cannot read the
+// response, so they cannot obtain a ticket this way.
+func (h *TerminalHandlers) HandleTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	email, _ := currentEmail(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"ticket": h.Tickets.Issue(email)})
+}
+
+// HandleWebSocket manages WebSocket connections for the terminal. The
+// handshake must come from an allowed origin and carry a ticket issued to
+// the signed-in user, in the "ticket" query parameter. A client
+// passing the "session" query parameter reattaches to its running session;
+// otherwise a new one is started on the backend of the course named in the
+// "course" parameter, falling back to the configured default. Viewers join
+// someone else's session with a "share" token, or as an admin with "watch"
+// and "access".
 func (h *TerminalHandlers) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	log.Println("New WebSocket connection...")
 
+	if !h.checkOrigin(r) {
+		log.Printf("Rejected WebSocket connection from origin %q", r.Header.Get("Origin"))
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	// Check for valid session
 	session, err := h.SessionStore.Get(r, "auth-session")
 	if err != nil {
@@ -58,6 +148,60 @@ func (h *TerminalHandlers) HandleWebSocket(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if !h.Tickets.Redeem(r.URL.Query().Get("ticket"), email) {
+		log.Printf("WebSocket connection for %s without a valid ticket.", email)
+		http.Error(w, "Invalid or expired terminal ticket", http.StatusForbidden)
+		return
+	}
+
+	if token := r.URL.Query().Get("share"); token != "" {
+		live, access, ok := h.Sessions.Redeem(token)
+		if !ok {
+			http.Error(w, "Share link is invalid or has expired", http.StatusNotFound)
+			return
+		}
+		h.watch(w, r, live, terminal.Viewer{Email: email, Access: access}, "link")
+		return
+	}
+
+	if id := r.URL.Query().Get("watch"); id != "" {
+		user, err := h.DB.GetUser(email)
+		if err != nil || user.Role != models.RoleAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		live, ok := h.Sessions.Get(id)
+		if !ok {
+			http.Error(w, "Terminal session not found", http.StatusNotFound)
+			return
+		}
+		access := r.URL.Query().Get("access")
+		if access != terminal.AccessControl {
+			access = terminal.AccessObserve
+		}
+		h.watch(w, r, live, terminal.Viewer{Email: email, Access: access}, "admin")
+		return
+	}
+
+	// Reattach to a detached session. Sessions belonging to someone else are
+	// treated as missing, and a fresh session is started instead.
+	if id := r.URL.Query().Get("session"); id != "" {
+		if live, ok := h.Sessions.Get(id); ok && live.Info().UserEmail == email {
+			conn, err := h.upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				log.Printf("Failed to upgrade connection: %v", err)
+				return
+			}
+			defer conn.Close()
+
+			log.Printf("Reattaching %s to terminal session %s", email, id)
+			h.logAccess(r, live.Info(), models.TerminalAccessEvent{ActorEmail: email, Action: models.TerminalAccessReattach})
+			live.Attach(conn, true)
+			log.Println("WebSocket connection closed.")
+			return
+		}
+	}
+
 	// Get user's tokens from database
 	user, err := h.DB.GetUser(email)
 	if err != nil {
@@ -66,96 +210,372 @@ func (h *TerminalHandlers) HandleWebSocket(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	ctx := context.Background()
+	courseID := r.URL.Query().Get("course")
+	course, err := h.courseFor(courseID)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading course %q: %v", courseID, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
-	// Handle token refresh if needed
-	if time.Now().After(user.TokenExpiry.Add(-1 * time.Minute)) {
-		log.Printf("User %s token is expired or expiring, attempting refresh...", user.Email)
-		token := &oauth2.Token{
-			AccessToken:  user.AccessToken,
-			RefreshToken: user.RefreshToken,
-			Expiry:       user.TokenExpiry,
-		}
-		tokenSource := h.OAuthConfig.TokenSource(ctx, token)
-		newToken, err := tokenSource.Token()
-		if err != nil {
+	backend, err := h.Backends.Get(course.Backend)
+	if err != nil {
+		log.Printf("No terminal backend for course %q: %v", courseID, err)
+		http.Error(w, "Terminal backend unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	if backend.RequiresGoogleToken() {
+		if err := h.refreshToken(&user); err != nil {
 			log.Printf("Failed to refresh token for %s: %v", user.Email, err)
 			http.Error(w, "Failed to refresh session token", http.StatusUnauthorized)
 			return
 		}
-		if newToken.AccessToken != user.AccessToken {
-			log.Printf("Token successfully refreshed for %s", user.Email)
-			user.AccessToken = newToken.AccessToken
-			if newToken.RefreshToken != "" {
-				user.RefreshToken = newToken.RefreshToken
-			}
-			user.TokenExpiry = newToken.Expiry
-			if err := h.DB.SaveUser(user); err != nil {
-				log.Printf("Failed to save refreshed token to DB for %s: %v", user.Email, err)
-			}
-		}
 	}
 
 	// Upgrade to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
 		return
 	}
 	defer conn.Close()
 
-	// Start gcloud command with port forwarding
-	log.Println("Starting gcloud ssh with port forwarding...")
-	portForwardFlag := "-L 9090:localhost:8080"
+	if err := h.Sessions.Admit(user.Email); err != nil {
+		log.Printf("Refusing terminal session for %s: %v", user.Email, err)
+		refuseSession(conn, err)
+		return
+	}
 
-	cmd := exec.Command("gcloud", "cloud-shell", "ssh",
-		"--authorize-session",
-		"--quiet",
-		"--ssh-flag="+portForwardFlag,
-	)
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, "CLOUDSDK_AUTH_ACCESS_TOKEN="+user.AccessToken)
+	termSession := terminal.Session{
+		ID:         terminal.NewSessionID(),
+		UserEmail:  user.Email,
+		CourseID:   courseID,
+		Backend:    backend.Name(),
+		RemoteAddr: auth.ClientIP(r),
+		StartedAt:  time.Now(),
+		Recording:  h.Recordings != nil && h.Recordings.Enabled(course.Record),
+	}
+	opts := terminal.StartOptions{OnExit: h.recordTerminalSession}
 
-	// Start command in PTY
-	ptmx, err := pty.Start(cmd)
-	if err != nil {
-		log.Printf("Failed to start pty: %v", err)
-		conn.WriteMessage(websocket.TextMessage, []byte("Failed to start remote shell."))
-		return
+	if termSession.Recording {
+		recorder, err := h.startRecording(termSession, course)
+		if err != nil {
+			// Sessions that must be recorded do not run unrecorded
+			log.Printf("Failed to start recording for %s: %v", user.Email, err)
+			refuseSession(conn, errRecordingFailed)
+			return
+		}
+		opts.Taps = append(opts.Taps, recorder)
+		opts.OnExit = func(live *terminal.LiveSession) {
+			h.recordTerminalSession(live)
+			if err := h.DB.FinishRecording(termSession.ID, time.Now(), recorder.Size()); err != nil {
+				log.Printf("Failed to finish recording %s: %v", termSession.ID, err)
+			}
+		}
 	}
-	defer ptmx.Close()
-	log.Println("PTY started successfully.")
 
-	// Bridge PTY and WebSocket
-	go func() {
-		buf := make([]byte, 1024)
-		for {
-			n, err := ptmx.Read(buf)
+	if h.CommandAudit != nil {
+		opts.Taps = append(opts.Taps, audit.NewTap(h.CommandAudit.Redactor, func(cmd audit.Command) {
+			h.saveCommand(termSession, cmd)
+		}))
+	}
+
+	launch := terminal.Launch{
+		SessionID: termSession.ID,
+		User:      user,
+		CourseID:  courseID,
+	}
+
+	// Give the session its own local ports for the editor and preview
+	// forwards, so /editor/ and /preview/ reach this user's environment and
+	// nobody else's
+	var cleanups []func()
+	var reserved []int
+	if forwarder, ok := backend.(terminal.PortForwarder); ok {
+		reserve := func(what string) int {
+			port, err := h.EditorPorts.Reserve()
 			if err != nil {
-				log.Println("PTY read error:", err)
-				conn.Close()
-				return
-			}
-			if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
-				log.Println("WebSocket write error:", err)
-				return
+				// The terminal still works without the forward
+				log.Printf("No %s port for %s: %v", what, user.Email, err)
+				return 0
 			}
+			reserved = append(reserved, port)
+			return port
 		}
-	}()
-
-	for {
-		msgType, msg, err := conn.ReadMessage()
-		if err != nil {
-			log.Println("WebSocket read error:", err)
-			break
+		if forwarder.RemoteEditorPort() != 0 {
+			launch.EditorPort = reserve("editor")
+			termSession.EditorPort = launch.EditorPort
 		}
-
-		if msgType == websocket.BinaryMessage {
-			if _, err := ptmx.Write(msg); err != nil {
-				log.Println("PTY write error:", err)
-				break
+		for _, remote := range forwarder.RemotePreviewPorts() {
+			if port := reserve("preview"); port != 0 {
+				if launch.PreviewPorts == nil {
+					launch.PreviewPorts = make(map[int]int)
+				}
+				launch.PreviewPorts[remote] = port
+			}
+		}
+		termSession.PreviewPorts = launch.PreviewPorts
+		cleanups = append(cleanups, func() { h.releasePorts(reserved) })
+	}
+	if cleaner, ok := backend.(terminal.Cleaner); ok {
+		cleanups = append(cleanups, func() {
+			if err := cleaner.Cleanup(launch); err != nil {
+				log.Printf("Failed to clean up terminal session %s: %v", launch.SessionID, err)
 			}
+		})
+	}
+	opts.Cleanup = func() {
+		for _, cleanup := range cleanups {
+			cleanup()
+		}
+	}
+	// abandon releases what was set up for a session that never started
+	abandon := func() {
+		for _, tap := range opts.Taps {
+			tap.Close()
 		}
+		h.releasePorts(reserved)
 	}
+
+	cmd, err := backend.Command(launch)
+	if err != nil {
+		log.Printf("Failed to prepare %s backend for %s: %v", backend.Name(), user.Email, err)
+		abandon()
+		refuseSession(conn, err)
+		return
+	}
+
+	// Start command in PTY. The session keeps running if this connection
+	// drops, and records time spent in the terminal once it ends.
+	log.Printf("Starting %s terminal for %s...", backend.Name(), user.Email)
+	live, err := h.Sessions.Start(termSession, cmd, opts)
+	if err != nil {
+		log.Printf("Failed to start pty: %v", err)
+		abandon()
+		refuseSession(conn, err)
+		return
+	}
+	log.Println("PTY started successfully.")
+	h.logAccess(r, termSession, models.TerminalAccessEvent{ActorEmail: user.Email, Action: models.TerminalAccessStart})
+
+	live.Attach(conn, false)
 	log.Println("WebSocket connection closed.")
 }
+
+// refuseSession tells the client why its session could not start and closes
+// the socket: with "try again later" when a limit was hit, otherwise as an
+// internal error
+func refuseSession(conn *websocket.Conn, err error) {
+	code, text := websocket.CloseInternalServerErr, "Failed to start remote shell."
+	switch {
+	case errors.Is(err, terminal.ErrUserSessionLimit):
+		code, text = websocket.CloseTryAgainLater, "You have too many terminal sessions open. Close one (type exit) and try again."
+	case errors.Is(err, terminal.ErrSessionLimit):
+		code, text = websocket.CloseTryAgainLater, "The lab server is at capacity. Please try again in a few minutes."
+	case errors.Is(err, errRecordingFailed):
+		text = "Failed to start session recording."
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(text))
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+}
+
+// watch attaches a viewer to someone else's session. via records how access
+// was granted: "link" or "admin".
+func (h *TerminalHandlers) watch(w http.ResponseWriter, r *http.Request, live *terminal.LiveSession, viewer terminal.Viewer, via string) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	info := live.Info()
+	log.Printf("%s is watching terminal session %s of %s (%s, via %s)", viewer.Email, info.ID, info.UserEmail, viewer.Access, via)
+	h.logAccess(r, info, models.TerminalAccessEvent{
+		ActorEmail: viewer.Email,
+		Action:     models.TerminalAccessWatch,
+		Access:     viewer.Access,
+		Via:        via,
+	})
+	live.Watch(conn, viewer)
+	log.Println("WebSocket viewer connection closed.")
+}
+
+// HandleShare creates a share link for one of the user's running sessions
+// (POST /terminal/sessions/{id}/share). The "access" form value is observe
+// or control; the link is returned as JSON.
+func (h *TerminalHandlers) HandleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, _ := currentEmail(r)
+	live, ok := h.Sessions.Get(r.PathValue("id"))
+	if !ok || live.Info().UserEmail != email {
+		http.NotFound(w, r)
+		return
+	}
+
+	access := r.FormValue("access")
+	token, err := h.Sessions.Share(live.Info().ID, access)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.logAccess(r, live.Info(), models.TerminalAccessEvent{ActorEmail: email, Action: models.TerminalAccessShare, Access: access})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"url":    "/terminal/?share=" + token,
+		"access": access,
+	})
+}
+
+// HandleUnshare stops sharing a session and disconnects its viewers
+// (POST /terminal/sessions/{id}/unshare). Owners and admins may do this.
+func (h *TerminalHandlers) HandleUnshare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _ := middleware.UserFromContext(r.Context())
+	live, ok := h.Sessions.Get(r.PathValue("id"))
+	if !ok || user == nil || (live.Info().UserEmail != user.Email && user.Role != models.RoleAdmin) {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.Sessions.Unshare(live.Info().ID)
+	h.logAccess(r, live.Info(), models.TerminalAccessEvent{ActorEmail: user.Email, Action: models.TerminalAccessUnshare})
+
+	// Admins stop sharing from the sessions page; owners from the terminal
+	if r.FormValue("redirect") == "admin" {
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logAccess writes a terminal access audit event for a session
+func (h *TerminalHandlers) logAccess(r *http.Request, info terminal.Session, event models.TerminalAccessEvent) {
+	event.SessionID = info.ID
+	event.SessionOwner = info.UserEmail
+	event.IPAddress = auth.ClientIP(r)
+	if err := h.DB.LogTerminalAccess(event); err != nil {
+		log.Printf("Failed to log terminal access: %v", err)
+	}
+}
+
+// recordTerminalSession records the time spent in a terminal session once its
+// process has ended
+func (h *TerminalHandlers) recordTerminalSession(live *terminal.LiveSession) {
+	info := live.Info()
+	err := h.DB.RecordActivity(models.ActivityEvent{
+		UserEmail:       info.UserEmail,
+		Type:            models.ActivityTerminalSession,
+		CourseID:        info.CourseID,
+		DurationSeconds: int64(time.Since(info.StartedAt).Seconds()),
+	})
+	if err != nil {
+		log.Printf("Failed to record terminal session for %s: %v", info.UserEmail, err)
+	}
+}
+
+// releasePorts returns a session's forward ports to the pool
+func (h *TerminalHandlers) releasePorts(ports []int) {
+	for _, port := range ports {
+		h.EditorPorts.Release(port)
+	}
+}
+
+// saveCommand stores an audited command run in a session
+func (h *TerminalHandlers) saveCommand(info terminal.Session, cmd audit.Command) {
+	err := h.DB.SaveCommand(models.CommandRecord{
+		SessionID:  info.ID,
+		UserEmail:  info.UserEmail,
+		CourseID:   info.CourseID,
+		Command:    cmd.Text,
+		ExitCode:   cmd.ExitCode,
+		Source:     cmd.Source,
+		ExecutedAt: cmd.ExecutedAt,
+		ExpiresAt:  cmd.ExecutedAt.Add(h.CommandAudit.Retention),
+	})
+	if err != nil {
+		log.Printf("Failed to save audited command: %v", err)
+	}
+}
+
+// courseFor loads the course a terminal session is for. Sessions outside a
+// course get an empty course, which selects the default backend and policy.
+func (h *TerminalHandlers) courseFor(courseID string) (models.Course, error) {
+	if courseID == "" {
+		return models.Course{}, nil
+	}
+	return h.DB.GetCourse(courseID)
+}
+
+// startRecording creates the asciicast file and metadata for a session
+func (h *TerminalHandlers) startRecording(info terminal.Session, course models.Course) (*recording.Recorder, error) {
+	title := info.UserEmail
+	if course.Title != "" {
+		title += " - " + course.Title
+	}
+
+	recorder, path, err := h.Recordings.Create(info.UserEmail, info.ID, title)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.DB.SaveRecording(models.Recording{
+		ID:        info.ID,
+		UserEmail: info.UserEmail,
+		CourseID:  info.CourseID,
+		Path:      path,
+		StartedAt: info.StartedAt,
+	})
+	if err != nil {
+		recorder.Close()
+		return nil, err
+	}
+	return recorder, nil
+}
+
+// refreshToken renews the user's OAuth access token when it is expired or
+// about to expire, saving the new token
+func (h *TerminalHandlers) refreshToken(user *models.User) error {
+	if !time.Now().After(user.TokenExpiry.Add(-1 * time.Minute)) {
+		return nil
+	}
+
+	log.Printf("User %s token is expired or expiring, attempting refresh...", user.Email)
+	token := &oauth2.Token{
+		AccessToken:  user.AccessToken,
+		RefreshToken: user.RefreshToken,
+		Expiry:       user.TokenExpiry,
+	}
+	newToken, err := h.OAuthConfig.TokenSource(context.Background(), token).Token()
+	if err != nil {
+		return err
+	}
+
+	if newToken.AccessToken != user.AccessToken {
+		log.Printf("Token successfully refreshed for %s", user.Email)
+		user.AccessToken = newToken.AccessToken
+		if newToken.RefreshToken != "" {
+			user.RefreshToken = newToken.RefreshToken
+		}
+		user.TokenExpiry = newToken.Expiry
+		if err := h.DB.UpdateUserTokens(*user); err != nil {
+			log.Printf("Failed to save refreshed token to DB for %s: %v", user.Email, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"supreme-broccoli/internal/terminal"
+)
+
+// uploadOverhead allows for the multipart framing around an uploaded file
+const uploadOverhead = 64 * 1024
+
+// HandleUpload copies a file into the working directory of one of the user's
+// running sessions (POST /terminal/sessions/{id}/upload). The body is a
+// multipart form with the file in the "file" field; the "size" query value
+// is its size, used for early rejection and progress reporting.
+func (h *TerminalHandlers) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	size, _ := strconv.ParseInt(r.URL.Query().Get("size"), 10, 64)
+	if size > h.TransferLimit || r.ContentLength > h.TransferLimit+uploadOverhead {
+		http.Error(w, terminal.ErrTransferTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	live, launch, transferer, ok := h.transferTarget(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.TransferLimit+uploadOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart upload", http.StatusBadRequest)
+		return
+	}
+	var part io.Reader
+	var name string
+	for {
+		p, err := reader.NextPart()
+		if err != nil {
+			http.Error(w, "No file uploaded", http.StatusBadRequest)
+			return
+		}
+		if p.FormName() == "file" {
+			part, name = p, uploadName(p.FileName())
+			break
+		}
+	}
+	if name == "" {
+		http.Error(w, "Invalid file name", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Uploading %s into terminal session %s of %s", name, launch.SessionID, launch.User.Email)
+	transfer := live.NewTransfer(terminal.TransferUpload, name, size, h.TransferLimit)
+	err = transfer.Finish(transferer.Upload(launch, name, transfer.Reader(part)))
+	if errors.Is(err, terminal.ErrTransferTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("Upload of %s into terminal session %s failed: %v", name, launch.SessionID, err)
+		http.Error(w, "Upload failed", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name": name,
+		"size": transfer.Bytes(),
+	})
+}
+
+// HandleDownload copies a file out of one of the user's running sessions
+// (GET /terminal/sessions/{id}/download?path=...). The file is staged on this
+// server first so the size limit applies before anything is sent, and the
+// response carries a Content-Length the browser can show progress against.
+func (h *TerminalHandlers) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	remotePath := r.URL.Query().Get("path")
+	if remotePath == "" {
+		http.Error(w, "Missing path", http.StatusBadRequest)
+		return
+	}
+
+	live, launch, transferer, ok := h.transferTarget(w, r)
+	if !ok {
+		return
+	}
+
+	staged, err := os.CreateTemp("", "cloudlab-download-*")
+	if err != nil {
+		log.Printf("Failed to stage download: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+
+	log.Printf("Downloading %s from terminal session %s of %s", remotePath, launch.SessionID, launch.User.Email)
+	transfer := live.NewTransfer(terminal.TransferDownload, remotePath, 0, h.TransferLimit)
+	err = transfer.Finish(transferer.Download(launch, remotePath, transfer.Writer(staged)))
+	if errors.Is(err, terminal.ErrTransferTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("Download of %s from terminal session %s failed: %v", remotePath, launch.SessionID, err)
+		http.Error(w, "Download failed; check that the file exists and is readable", http.StatusBadGateway)
+		return
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(remotePath)}))
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, "", time.Now(), staged)
+}
+
+// transferTarget resolves the session a transfer request is for, which must
+// be running and belong to the user, and the launch details its backend
+// needs. It writes the error response itself when ok is false.
+func (h *TerminalHandlers) transferTarget(w http.ResponseWriter, r *http.Request) (*terminal.LiveSession, terminal.Launch, terminal.Transferer, bool) {
+	email, _ := currentEmail(r)
+	live, ok := h.Sessions.Get(r.PathValue("id"))
+	if !ok || live.Info().UserEmail != email {
+		http.NotFound(w, r)
+		return nil, terminal.Launch{}, nil, false
+	}
+	info := live.Info()
+
+	backend, err := h.Backends.Get(info.Backend)
+	if err != nil {
+		http.Error(w, "Terminal backend unavailable", http.StatusServiceUnavailable)
+		return nil, terminal.Launch{}, nil, false
+	}
+	transferer, ok := backend.(terminal.Transferer)
+	if !ok {
+		http.Error(w, "File transfer is not supported for this terminal", http.StatusNotImplemented)
+		return nil, terminal.Launch{}, nil, false
+	}
+
+	user, err := h.DB.GetUser(email)
+	if err != nil {
+		log.Printf("Failed to get user %s from DB: %v", email, err)
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return nil, terminal.Launch{}, nil, false
+	}
+	if backend.RequiresGoogleToken() {
+		if err := h.refreshToken(&user); err != nil {
+			log.Printf("Failed to refresh token for %s: %v", user.Email, err)
+			http.Error(w, "Failed to refresh session token", http.StatusUnauthorized)
+			return nil, terminal.Launch{}, nil, false
+		}
+	}
+
+	launch := terminal.Launch{
+		SessionID: info.ID,
+		User:      user,
+		CourseID:  info.CourseID,
+	}
+	return live, launch, transferer, true
+}
+
+// uploadName reduces a browser-supplied file name to a plain name in the
+// working directory, or "" if nothing usable is left
+func uploadName(filename string) string {
+	name := path.Base(path.Clean("/" + filename))
+	if name == "/" || name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
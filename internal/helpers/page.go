@@ -1,9 +1,15 @@
 package helpers
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"time"
 
+	"supreme-broccoli/internal/database"
+	"supreme-broccoli/internal/middleware"
 	"supreme-broccoli/internal/models"
+	"supreme-broccoli/internal/terminal"
 
 	"github.com/gorilla/sessions"
 )
@@ -24,6 +30,13 @@ type CourseWithProgress struct {
 	Enrolled bool
 }
 
+// CourseDetailPageData extends PageData with a single course and the user's progress
+type CourseDetailPageData struct {
+	PageData
+	Course           CourseWithProgress
+	CompletedModules map[int]bool
+}
+
 // ProfilePageData extends PageData with profile-specific data
 type ProfilePageData struct {
 	PageData
@@ -41,7 +54,7 @@ type ProfileStats struct {
 
 // ActivityItem represents a recent activity entry
 type ActivityItem struct {
-	Type        string // "course", "completion", "login"
+	Type        string // "course", "completion", "login", "terminal"
 	Title       string
 	Description string
 	TimeAgo     string
@@ -50,9 +63,27 @@ type ActivityItem struct {
 // SettingsPageData extends PageData with settings-specific data
 type SettingsPageData struct {
 	PageData
-	Settings       models.UserSettings
-	SuccessMessage string
-	ErrorMessage   string
+	Settings         models.UserSettings
+	Sessions         []models.SessionRecord
+	CurrentSessionID string
+	SuccessMessage   string
+	ErrorMessage     string
+}
+
+// TerminalPageData extends PageData with the user's terminal preferences
+type TerminalPageData struct {
+	PageData
+	Settings models.UserSettings
+	CourseID string // course whose lab backend the terminal connects to, if any
+
+	// Set when viewing someone else's session: a share link token, or the
+	// session an admin is watching with the requested access level
+	ShareToken string
+	WatchID    string
+	Access     string
+
+	// Ticket authorizes the page's first WebSocket handshake
+	Ticket string
 }
 
 // ContactPageData extends PageData with contact-specific data
@@ -62,101 +93,186 @@ type ContactPageData struct {
 	ErrorMessage   string
 }
 
-// GetPageData creates a PageData struct from the current session
-func GetPageData(r *http.Request, sessionStore *sessions.CookieStore, activePage string) *models.PageData {
-	session, _ := sessionStore.Get(r, "auth-session")
-	
+// AdminPageData extends PageData with state shared by all admin console pages
+type AdminPageData struct {
+	PageData
+	AdminSection   string
+	SuccessMessage string
+	ErrorMessage   string
+}
+
+// AdminDashboardPageData extends AdminPageData with overview counts
+type AdminDashboardPageData struct {
+	AdminPageData
+	UserCount      int
+	AdminCount     int
+	ActiveSessions int
+	CourseCount    int
+	NewMessages    int
+}
+
+// AdminUsersPageData extends AdminPageData with the user list
+type AdminUsersPageData struct {
+	AdminPageData
+	Users          []models.User
+	ActiveSessions map[string]int // running terminal sessions per user email
+}
+
+// AdminSessionsPageData extends AdminPageData with running terminal sessions
+type AdminSessionsPageData struct {
+	AdminPageData
+	Sessions  []terminal.Session
+	AccessLog []models.TerminalAccessEvent // most recent attaches and shares
+}
+
+// AdminCoursesPageData extends AdminPageData with the course catalog
+type AdminCoursesPageData struct {
+	AdminPageData
+	Courses []models.Course
+}
+
+// AdminCourseFormPageData extends AdminPageData with a course being created or edited
+type AdminCourseFormPageData struct {
+	AdminPageData
+	Course         models.Course
+	ModulesText    string
+	IsNew          bool
+	Backends       []string // configured terminal backends
+	DefaultBackend string
+}
+
+// AdminMessagesPageData extends AdminPageData with the contact message inbox
+type AdminMessagesPageData struct {
+	AdminPageData
+	Messages     []models.ContactMessage
+	StatusFilter string
+	Counts       map[string]int
+}
+
+// AdminRecordingsPageData extends AdminPageData with terminal session recordings
+type AdminRecordingsPageData struct {
+	AdminPageData
+	Recordings []models.Recording
+	UserFilter string
+	Policy     string // the configured recording policy
+}
+
+// AdminCommandsPageData extends AdminPageData with command audit records
+type AdminCommandsPageData struct {
+	AdminPageData
+	Commands      []models.CommandRecord
+	UserFilter    string
+	SessionFilter string
+	TextFilter    string
+	Enabled       bool   // whether commands are being audited
+	Retention     string // how long records are kept, e.g. "90 days"
+}
+
+// RecordingPageData extends PageData with a recording to play back
+type RecordingPageData struct {
+	PageData
+	Recording models.Recording
+}
+
+// PreviewPageData extends PageData with a preview that can't be shown
+type PreviewPageData struct {
+	PageData
+	Port           int
+	SessionRunning bool // a session forwards the port, but nothing answered
+}
+
+// GetPageData creates a PageData struct for the current request. It uses the
+// user resolved by the auth middleware when present; otherwise it reads the
+// session and loads the stored user record when a database is available.
+func GetPageData(r *http.Request, sessionStore sessions.Store, db *database.MongoDB, activePage string) *models.PageData {
 	pageData := &models.PageData{
 		IsAuthenticated: false,
 		ActivePage:      activePage,
 		User:            nil,
 	}
 
-	// Check if user is authenticated
-	if email, ok := session.Values["email"].(string); ok && email != "" {
-		pageData.IsAuthenticated = true
-		
-		// Create a basic user object from session data
-		user := &models.User{
-			Email: email,
+	// Routes behind the auth middleware already carry the resolved user
+	if current, ok := middleware.UserFromContext(r.Context()); ok {
+		user := *current
+		if user.Settings.TerminalFontSize == 0 {
+			user.Settings = models.DefaultSettings()
 		}
-		
-		// Add role if available in session
-		if role, ok := session.Values["role"].(string); ok {
-			user.Role = role
+		pageData.IsAuthenticated = true
+		pageData.User = &user
+		return pageData
+	}
+
+	session, _ := sessionStore.Get(r, "auth-session")
+
+	// Check if user is authenticated
+	email, ok := session.Values["email"].(string)
+	if !ok || email == "" {
+		return pageData
+	}
+	pageData.IsAuthenticated = true
+
+	// Start from session data so pages still render if the lookup fails
+	user := &models.User{
+		Email: email,
+	}
+	if role, ok := session.Values["role"].(string); ok {
+		user.Role = role
+	}
+
+	if db != nil {
+		stored, err := db.GetUser(email)
+		if err != nil {
+			log.Printf("Failed to load user %s for page data: %v", email, err)
+		} else {
+			// Tokens are never needed by templates
+			stored.AccessToken = ""
+			stored.RefreshToken = ""
+			user = &stored
 		}
-		
-		pageData.User = user
 	}
 
+	if user.Settings.TerminalFontSize == 0 {
+		user.Settings = models.DefaultSettings()
+	}
+
+	pageData.User = user
+
 	return pageData
 }
 
-// GetCoursesWithProgress returns courses with user progress information
-// For now, this returns mock data with sample progress for demonstration
-func GetCoursesWithProgress(user *models.User) []CourseWithProgress {
-	// Get mock courses
-	courses := models.GetMockCourses()
-	
-	// Convert to CourseWithProgress with mock progress data
+// GetCoursesWithProgress combines the course catalog with a user's progress records
+func GetCoursesWithProgress(courses []models.Course, progress []models.UserProgress) []CourseWithProgress {
+	// Index progress by course for quick lookup
+	progressByCourse := make(map[string]models.UserProgress, len(progress))
+	for _, p := range progress {
+		progressByCourse[p.CourseID] = p
+	}
+
 	coursesWithProgress := make([]CourseWithProgress, len(courses))
-	
 	for i, course := range courses {
-		// Mock progress data - in a real app, this would come from the database
-		enrolled := false
-		progress := 0
-		
-		// For demonstration, mark first 2 courses as enrolled with progress
-		if user != nil && i < 2 {
-			enrolled = true
-			if i == 0 {
-				progress = 65 // First course 65% complete
-			} else {
-				progress = 30 // Second course 30% complete
-			}
-		}
-		
+		p := progressByCourse[course.ID]
 		coursesWithProgress[i] = CourseWithProgress{
 			Course:   course,
-			Progress: progress,
-			Enrolled: enrolled,
+			Progress: p.Progress,
+			Enrolled: p.Enrolled,
 		}
 	}
-	
+
 	return coursesWithProgress
 }
 
-
-// GetProfileData returns profile page data with mock statistics and activity
-func GetProfileData(user *models.User) ProfilePageData {
-	// Mock statistics - in a real app, this would come from the database
+// GetProfileData builds profile statistics and the activity feed from stored events
+func GetProfileData(summary models.ActivitySummary, events []models.ActivityEvent, now time.Time) ProfilePageData {
 	stats := ProfileStats{
-		EnrolledCourses:  2,
-		CompletedCourses: 0,
-		LearningHours:    12,
-		CurrentStreak:    5,
-	}
-
-	// Mock recent activity - in a real app, this would come from the database
-	recentActivity := []ActivityItem{
-		{
-			Type:        "course",
-			Title:       "Started Kubernetes Essentials",
-			Description: "Began learning container orchestration",
-			TimeAgo:     "2 hours ago",
-		},
-		{
-			Type:        "course",
-			Title:       "Continued GCP Fundamentals",
-			Description: "Completed module 3: Cloud Storage",
-			TimeAgo:     "1 day ago",
-		},
-		{
-			Type:        "course",
-			Title:       "Enrolled in GCP Fundamentals",
-			Description: "Started your cloud learning journey",
-			TimeAgo:     "3 days ago",
-		},
+		EnrolledCourses:  summary.EnrolledCourses,
+		CompletedCourses: summary.CompletedCourses,
+		LearningHours:    int(summary.TerminalSeconds / 3600),
+		CurrentStreak:    CurrentStreak(summary.ActiveDays, now),
+	}
+
+	recentActivity := make([]ActivityItem, 0, len(events))
+	for _, event := range events {
+		recentActivity = append(recentActivity, activityItem(event, now))
 	}
 
 	return ProfilePageData{
@@ -164,3 +280,116 @@ func GetProfileData(user *models.User) ProfilePageData {
 		RecentActivity: recentActivity,
 	}
 }
+
+// activityItem describes a single activity event for the profile feed
+func activityItem(event models.ActivityEvent, now time.Time) ActivityItem {
+	item := ActivityItem{
+		Type:    "course",
+		TimeAgo: TimeAgo(event.CreatedAt, now),
+	}
+
+	switch event.Type {
+	case models.ActivityLogin:
+		item.Type = "login"
+		item.Title = "Signed in"
+		item.Description = "Started a new session"
+	case models.ActivityEnrollment:
+		item.Title = "Enrolled in " + event.CourseTitle
+		item.Description = "Started a new course"
+	case models.ActivityUnenrollment:
+		item.Title = "Left " + event.CourseTitle
+		item.Description = "Unenrolled from the course"
+	case models.ActivityLabCompletion:
+		item.Type = "completion"
+		item.Title = "Completed a lab in " + event.CourseTitle
+		item.Description = event.Detail
+	case models.ActivityCourseCompletion:
+		item.Type = "completion"
+		item.Title = "Completed " + event.CourseTitle
+		item.Description = "Finished every lab in the course"
+	case models.ActivityTerminalSession:
+		item.Type = "terminal"
+		item.Title = "Terminal session"
+		item.Description = fmt.Sprintf("Spent %s in the terminal", formatDuration(time.Duration(event.DurationSeconds)*time.Second))
+	default:
+		item.Title = event.Type
+		item.Description = event.Detail
+	}
+
+	return item
+}
+
+// CurrentStreak counts consecutive active days ending today, or yesterday if
+// the user has not been active yet today. activeDays must be sorted most recent first.
+func CurrentStreak(activeDays []time.Time, now time.Time) int {
+	if len(activeDays) == 0 {
+		return 0
+	}
+
+	today := truncateDay(now)
+	expected := today
+	if truncateDay(activeDays[0]).Before(today) {
+		expected = today.AddDate(0, 0, -1)
+	}
+
+	streak := 0
+	for _, day := range activeDays {
+		day = truncateDay(day)
+		if day.After(expected) {
+			continue
+		}
+		if !day.Equal(expected) {
+			break
+		}
+		streak++
+		expected = expected.AddDate(0, 0, -1)
+	}
+
+	return streak
+}
+
+// TimeAgo formats how long before now t occurred, e.g. "3 hours ago"
+func TimeAgo(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return pluralize(int(d/time.Minute), "minute") + " ago"
+	case d < 24*time.Hour:
+		return pluralize(int(d/time.Hour), "hour") + " ago"
+	case d < 30*24*time.Hour:
+		return pluralize(int(d/(24*time.Hour)), "day") + " ago"
+	case d < 365*24*time.Hour:
+		return pluralize(int(d/(30*24*time.Hour)), "month") + " ago"
+	default:
+		return pluralize(int(d/(365*24*time.Hour)), "year") + " ago"
+	}
+}
+
+// formatDuration formats a session length in hours and minutes
+func formatDuration(d time.Duration) string {
+	if d < time.Hour {
+		return pluralize(int(d/time.Minute), "minute")
+	}
+	hours := int(d / time.Hour)
+	minutes := int((d % time.Hour) / time.Minute)
+	if minutes == 0 {
+		return pluralize(hours, "hour")
+	}
+	return pluralize(hours, "hour") + " " + pluralize(minutes, "minute")
+}
+
+// pluralize formats a count with a singular or plural unit
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// truncateDay returns midnight UTC of t's UTC date
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
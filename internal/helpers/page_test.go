@@ -0,0 +1,77 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"supreme-broccoli/internal/models"
+)
+
+// TestCurrentStreak verifies streaks count consecutive active days
+func TestCurrentStreak(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	day := func(offset int) time.Time {
+		return time.Date(2025, 3, 10+offset, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		days []time.Time
+		want int
+	}{
+		{"no activity", nil, 0},
+		{"active today only", []time.Time{day(0)}, 1},
+		{"three days ending today", []time.Time{day(0), day(-1), day(-2)}, 3},
+		{"not yet active today", []time.Time{day(-1), day(-2)}, 2},
+		{"gap breaks streak", []time.Time{day(0), day(-1), day(-3)}, 2},
+		{"last active two days ago", []time.Time{day(-2), day(-3)}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CurrentStreak(tt.days, now); got != tt.want {
+				t.Errorf("Expected streak %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestTimeAgo verifies relative time formatting
+func TestTimeAgo(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{10 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{2 * time.Hour, "2 hours ago"},
+		{3 * 24 * time.Hour, "3 days ago"},
+		{400 * 24 * time.Hour, "1 year ago"},
+	}
+
+	for _, tt := range tests {
+		if got := TimeAgo(now.Add(-tt.ago), now); got != tt.want {
+			t.Errorf("Expected %q for %v, got %q", tt.want, tt.ago, got)
+		}
+	}
+}
+
+// TestGetCoursesWithProgress verifies progress is matched to the right course
+func TestGetCoursesWithProgress(t *testing.T) {
+	courses := []models.Course{{ID: "a"}, {ID: "b"}}
+	progress := []models.UserProgress{{CourseID: "b", Progress: 40, Enrolled: true}}
+
+	result := GetCoursesWithProgress(courses, progress)
+
+	if len(result) != 2 {
+		t.Fatalf("Expected 2 courses, got %d", len(result))
+	}
+	if result[0].Enrolled || result[0].Progress != 0 {
+		t.Error("Expected course a to have no progress")
+	}
+	if !result[1].Enrolled || result[1].Progress != 40 {
+		t.Errorf("Expected course b enrolled at 40%%, got enrolled=%v progress=%d", result[1].Enrolled, result[1].Progress)
+	}
+}
@@ -1,47 +1,84 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"net/url"
 
 	"github.com/gorilla/sessions"
+
+	"supreme-broccoli/internal/database"
+	"supreme-broccoli/internal/models"
 )
 
-// Auth checks if a user is authenticated
-func Auth(sessionStore *sessions.CookieStore) func(http.Handler) http.Handler {
+// Auth checks if a user is authenticated and puts the current user record
+// into the request context
+func Auth(sessionStore sessions.Store, users *UserCache) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			session, _ := sessionStore.Get(r, "auth-session")
-			email, ok := session.Values["email"].(string)
-
-			if !ok || email == "" {
-				http.Redirect(w, r, "/login", http.StatusSeeOther)
+			user, ok := resolveUser(w, r, sessionStore, users)
+			if !ok {
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
 		})
 	}
 }
 
-// Admin checks if a user is authenticated AND is an admin
-func Admin(sessionStore *sessions.CookieStore) func(http.Handler) http.Handler {
+// Admin checks if a user is authenticated AND is an admin. The role comes
+// from the user store rather than the session, so a demotion takes effect
+// within the cache TTL.
+func Admin(sessionStore sessions.Store, users *UserCache) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			session, _ := sessionStore.Get(r, "auth-session")
-			email, okEmail := session.Values["email"].(string)
-			role, okRole := session.Values["role"].(string)
-
-			if !okEmail || email == "" {
-				http.Redirect(w, r, "/login", http.StatusSeeOther)
+			user, ok := resolveUser(w, r, sessionStore, users)
+			if !ok {
 				return
 			}
 
-			if !okRole || role != "admin" {
+			if user.Role != models.RoleAdmin {
 				http.Error(w, "Forbidden: You do not have admin privileges.", http.StatusForbidden)
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
 		})
 	}
 }
+
+// resolveUser loads the user named by the session. It writes a response and
+// returns false when the request cannot proceed.
+func resolveUser(w http.ResponseWriter, r *http.Request, sessionStore sessions.Store, users *UserCache) (*models.User, bool) {
+	session, _ := sessionStore.Get(r, "auth-session")
+	email, ok := session.Values["email"].(string)
+	if !ok || email == "" {
+		redirectToLogin(w, r)
+		return nil, false
+	}
+
+	user, err := users.Get(email)
+	if errors.Is(err, database.ErrNotFound) {
+		// The account was removed after this session was created
+		redirectToLogin(w, r)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error loading user %s: %v", email, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// redirectToLogin sends the user to the login page, remembering where they were
+// headed so they can be returned there after signing in
+func redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	target := "/login"
+	if r.Method == http.MethodGet {
+		target += "?return_to=" + url.QueryEscape(r.URL.RequestURI())
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"supreme-broccoli/internal/database"
+	"supreme-broccoli/internal/models"
+)
+
+type fakeUserStore struct {
+	users map[string]models.User
+	loads int
+}
+
+func (f *fakeUserStore) GetUser(email string) (models.User, error) {
+	f.loads++
+	user, ok := f.users[email]
+	if !ok {
+		return models.User{}, fmt.Errorf("user %s: %w", email, database.ErrNotFound)
+	}
+	return user, nil
+}
+
+// requestWithSession returns a request carrying a session cookie for email,
+// with role "admin" stored in the session to prove the middleware ignores it
+func requestWithSession(t *testing.T, store sessions.Store, email string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	rr := httptest.NewRecorder()
+	session, _ := store.Get(req, "auth-session")
+	session.Values["email"] = email
+	session.Values["role"] = models.RoleAdmin
+	if err := session.Save(req, rr); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+
+	next := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	for _, c := range rr.Result().Cookies() {
+		next.AddCookie(c)
+	}
+	return next
+}
+
+func TestAdminUsesStoredRole(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("test-key"))
+	users := &fakeUserStore{users: map[string]models.User{
+		"admin@example.com":   {Email: "admin@example.com", Role: models.RoleAdmin, AccessToken: "secret"},
+		"demoted@example.com": {Email: "demoted@example.com", Role: models.RoleUser},
+	}}
+	cache := NewUserCache(users, time.Minute)
+
+	var seen *models.User
+	handler := Admin(store, cache)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = UserFromContext(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, requestWithSession(t, store, "admin@example.com"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected admin to be allowed, got %d", rr.Code)
+	}
+	if seen == nil || seen.Email != "admin@example.com" {
+		t.Fatalf("Expected user in request context, got %+v", seen)
+	}
+	if seen.AccessToken != "" {
+		t.Error("Expected tokens to be stripped from the cached user")
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, requestWithSession(t, store, "demoted@example.com"))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected demoted user to be forbidden despite session role, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, requestWithSession(t, store, "deleted@example.com"))
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("Expected unknown user to be redirected to login, got %d", rr.Code)
+	}
+}
+
+func TestUserCacheExpiryAndInvalidate(t *testing.T) {
+	users := &fakeUserStore{users: map[string]models.User{
+		"a@example.com": {Email: "a@example.com", Role: models.RoleAdmin},
+	}}
+	cache := NewUserCache(users, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Get("a@example.com")
+	cache.Get("a@example.com")
+	if users.loads != 1 {
+		t.Fatalf("Expected 1 load while cached, got %d", users.loads)
+	}
+
+	users.users["a@example.com"] = models.User{Email: "a@example.com", Role: models.RoleUser}
+	now = now.Add(2 * time.Minute)
+	user, _ := cache.Get("a@example.com")
+	if user.Role != models.RoleUser || users.loads != 2 {
+		t.Errorf("Expected reload after TTL, got role %q after %d loads", user.Role, users.loads)
+	}
+
+	cache.Invalidate("a@example.com")
+	cache.Get("a@example.com")
+	if users.loads != 3 {
+		t.Errorf("Expected reload after Invalidate, got %d loads", users.loads)
+	}
+}
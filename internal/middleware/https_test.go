@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHSTS(t *testing.T) {
+	handler := HSTS(365 * 24 * time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "https://lab.example.com/", nil))
+	if got := rr.Header().Get("Strict-Transport-Security"); got != "max-age=31536000" {
+		t.Errorf("Expected max-age=31536000, got %q", got)
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	handler := RedirectToHTTPS("lab.example.com")
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://evil.example.com/contact?x=1", nil)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusPermanentRedirect {
+		t.Errorf("Expected 308, got %d", rr.Code)
+	}
+	if loc := rr.Header().Get("Location"); loc != "https://lab.example.com/contact?x=1" {
+		t.Errorf("Expected redirect to our own host, got %q", loc)
+	}
+}
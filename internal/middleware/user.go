@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"supreme-broccoli/internal/models"
+)
+
+// DefaultUserCacheTTL bounds how long a role change can take to reach
+// requests served from the cache
+const DefaultUserCacheTTL = 30 * time.Second
+
+// UserStore loads users by email. *database.MongoDB satisfies it.
+type UserStore interface {
+	GetUser(email string) (models.User, error)
+}
+
+type cachedUser struct {
+	user    models.User
+	expires time.Time
+}
+
+// UserCache is a short-lived in-process cache of user records, so the
+// middleware can check the current role without a database round trip on
+// every request
+type UserCache struct {
+	store UserStore
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu        sync.Mutex
+	users     map[string]cachedUser
+	lastSweep time.Time
+}
+
+// NewUserCache creates a cache that keeps users loaded from store for ttl
+func NewUserCache(store UserStore, ttl time.Duration) *UserCache {
+	return &UserCache{
+		store: store,
+		ttl:   ttl,
+		now:   time.Now,
+		users: make(map[string]cachedUser),
+	}
+}
+
+// Get returns the user for email, loading it from the store when it is not
+// cached or the cached copy has expired. OAuth tokens are never cached.
+func (c *UserCache) Get(email string) (models.User, error) {
+	c.mu.Lock()
+	now := c.now()
+	if now.Sub(c.lastSweep) > c.ttl {
+		for key, entry := range c.users {
+			if now.After(entry.expires) {
+				delete(c.users, key)
+			}
+		}
+		c.lastSweep = now
+	}
+	entry, ok := c.users[email]
+	c.mu.Unlock()
+
+	if ok && now.Before(entry.expires) {
+		return entry.user, nil
+	}
+
+	user, err := c.store.GetUser(email)
+	if err != nil {
+		return models.User{}, err
+	}
+	user.AccessToken = ""
+	user.RefreshToken = ""
+
+	c.mu.Lock()
+	c.users[email] = cachedUser{user: user, expires: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return user, nil
+}
+
+// Invalidate drops the cached copy of a user so the next request reloads it
+func (c *UserCache) Invalidate(email string) {
+	c.mu.Lock()
+	delete(c.users, email)
+	c.mu.Unlock()
+}
+
+type contextKey struct{}
+
+// WithUser returns a copy of ctx carrying the authenticated user
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the user resolved by Auth or Admin for this request
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(contextKey{}).(*models.User)
+	return user, ok && user != nil
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Activity event types
+const (
+	ActivityLogin            = "login"
+	ActivityEnrollment       = "enrollment"
+	ActivityUnenrollment     = "unenrollment"
+	ActivityLabCompletion    = "lab_completion"
+	ActivityCourseCompletion = "course_completion"
+	ActivityTerminalSession  = "terminal_session"
+)
+
+// ActivityEvent records something a user did, used for profile stats and the activity feed
+type ActivityEvent struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserEmail       string             `bson:"user_email" json:"user_email"`
+	Type            string             `bson:"type" json:"type"`
+	CourseID        string             `bson:"course_id,omitempty" json:"course_id,omitempty"`
+	CourseTitle     string             `bson:"course_title,omitempty" json:"course_title,omitempty"`
+	Detail          string             `bson:"detail,omitempty" json:"detail,omitempty"`
+	DurationSeconds int64              `bson:"duration_seconds,omitempty" json:"duration_seconds,omitempty"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// ActivitySummary holds per-user totals aggregated from activity events
+type ActivitySummary struct {
+	EnrolledCourses  int
+	CompletedCourses int
+	TerminalSeconds  int64
+	ActiveDays       []time.Time // distinct UTC days with activity, most recent first
+}
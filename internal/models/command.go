@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CommandRecord is an audit record of a command run in a terminal session.
+// Secrets are redacted before the record is stored.
+type CommandRecord struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SessionID  string             `bson:"session_id" json:"session_id"`
+	UserEmail  string             `bson:"user_email" json:"user_email"`
+	CourseID   string             `bson:"course_id,omitempty" json:"course_id,omitempty"`
+	Command    string             `bson:"command" json:"command"`
+	ExitCode   *int               `bson:"exit_code,omitempty" json:"exit_code,omitempty"`
+	Source     string             `bson:"source" json:"source"` // "input" or "shell"; see the audit package
+	ExecutedAt time.Time          `bson:"executed_at" json:"executed_at"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"-"` // removed by MongoDB's TTL monitor after this
+}
@@ -2,6 +2,13 @@ package models
 
 import "time"
 
+// Contact message statuses
+const (
+	ContactStatusNew       = "new"
+	ContactStatusRead      = "read"
+	ContactStatusResponded = "responded"
+)
+
 // ContactMessage represents a contact form submission
 type ContactMessage struct {
 	ID        string    `bson:"_id" json:"id"`
@@ -9,6 +16,16 @@ type ContactMessage struct {
 	Email     string    `bson:"email" json:"email"`
 	Subject   string    `bson:"subject" json:"subject"`
 	Message   string    `bson:"message" json:"message"`
+	IPAddress string    `bson:"ip_address" json:"-"`
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	Status    string    `bson:"status" json:"status"` // "new", "read", "responded"
 }
+
+// IsValidContactStatus reports whether status is a known contact message status
+func IsValidContactStatus(status string) bool {
+	switch status {
+	case ContactStatusNew, ContactStatusRead, ContactStatusResponded:
+		return true
+	}
+	return false
+}
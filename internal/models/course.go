@@ -11,19 +11,30 @@ type Course struct {
 	Level       string   `bson:"level" json:"level"`
 	Thumbnail   string   `bson:"thumbnail" json:"thumbnail"`
 	Description string   `bson:"description" json:"description"`
+	Modules     []Module `bson:"modules" json:"modules"`
+	Backend     string   `bson:"backend,omitempty" json:"backend,omitempty"` // terminal backend for labs; empty uses the default
+	Record      bool     `bson:"record,omitempty" json:"record,omitempty"`   // record lab terminal sessions when the policy is "course"
+}
+
+// Module is a single unit of course content worked through in the terminal
+type Module struct {
+	Title       string `bson:"title" json:"title"`
+	Description string `bson:"description" json:"description"`
 }
 
 // UserProgress tracks a user's progress through a course
 type UserProgress struct {
-	UserEmail  string    `bson:"user_email" json:"user_email"`
-	CourseID   string    `bson:"course_id" json:"course_id"`
-	Progress   int       `bson:"progress" json:"progress"` // 0-100
-	Enrolled   bool      `bson:"enrolled" json:"enrolled"`
-	LastAccess time.Time `bson:"last_access" json:"last_access"`
+	UserEmail        string    `bson:"user_email" json:"user_email"`
+	CourseID         string    `bson:"course_id" json:"course_id"`
+	Progress         int       `bson:"progress" json:"progress"` // 0-100
+	Enrolled         bool      `bson:"enrolled" json:"enrolled"`
+	CompletedModules []int     `bson:"completed_modules" json:"completed_modules"` // indexes into Course.Modules
+	EnrolledAt       time.Time `bson:"enrolled_at" json:"enrolled_at"`
+	LastAccess       time.Time `bson:"last_access" json:"last_access"`
 }
 
-// GetMockCourses returns a slice of sample courses for development and testing
-func GetMockCourses() []Course {
+// DefaultCourses returns the starter catalog used to seed an empty courses collection
+func DefaultCourses() []Course {
 	return []Course{
 		{
 			ID:          "gcp-fundamentals",
@@ -33,6 +44,12 @@ func GetMockCourses() []Course {
 			Level:       "Beginner",
 			Thumbnail:   "/static/images/course-thumbnails/gcp-fundamentals.jpg",
 			Description: "Learn the basics of Google Cloud Platform including Compute Engine, Cloud Storage, and networking fundamentals.",
+			Modules: []Module{
+				{Title: "Projects and IAM", Description: "Create a project, explore the console and grant roles with gcloud."},
+				{Title: "Compute Engine", Description: "Launch, connect to and tear down a virtual machine."},
+				{Title: "Cloud Storage", Description: "Create buckets and move objects with gsutil."},
+				{Title: "VPC Networking", Description: "Build a custom network with subnets and firewall rules."},
+			},
 		},
 		{
 			ID:          "kubernetes-essentials",
@@ -42,6 +59,12 @@ func GetMockCourses() []Course {
 			Level:       "Intermediate",
 			Thumbnail:   "/static/images/course-thumbnails/kubernetes-essentials.jpg",
 			Description: "Master container orchestration with Kubernetes. Learn pods, deployments, services, and best practices.",
+			Modules: []Module{
+				{Title: "Clusters and kubectl", Description: "Create a GKE cluster and connect kubectl to it."},
+				{Title: "Pods and Deployments", Description: "Run workloads and roll out new versions."},
+				{Title: "Services and Ingress", Description: "Expose applications inside and outside the cluster."},
+				{Title: "Configuration", Description: "Manage ConfigMaps, Secrets and resource limits."},
+			},
 		},
 		{
 			ID:          "cloud-shell-mastery",
@@ -51,6 +74,11 @@ func GetMockCourses() []Course {
 			Level:       "Beginner",
 			Thumbnail:   "/static/images/course-thumbnails/cloud-shell-mastery.jpg",
 			Description: "Become proficient with Google Cloud Shell. Learn command-line tools, scripting, and productivity tips.",
+			Modules: []Module{
+				{Title: "Getting Around", Description: "Navigate the Cloud Shell environment and its persistent home directory."},
+				{Title: "Command-Line Tools", Description: "Use gcloud, gsutil and bq effectively."},
+				{Title: "Scripting", Description: "Automate repetitive tasks with shell scripts."},
+			},
 		},
 		{
 			ID:          "terraform-infrastructure",
@@ -60,6 +88,12 @@ func GetMockCourses() []Course {
 			Level:       "Advanced",
 			Thumbnail:   "/static/images/course-thumbnails/terraform-infrastructure.jpg",
 			Description: "Build and manage cloud infrastructure using Terraform. Learn modules, state management, and best practices.",
+			Modules: []Module{
+				{Title: "Terraform Basics", Description: "Write your first configuration and run plan and apply."},
+				{Title: "State Management", Description: "Store state remotely and understand locking."},
+				{Title: "Modules", Description: "Package reusable infrastructure as modules."},
+				{Title: "Workflows", Description: "Structure environments and review changes safely."},
+			},
 		},
 		{
 			ID:          "docker-containers",
@@ -69,6 +103,11 @@ func GetMockCourses() []Course {
 			Level:       "Intermediate",
 			Thumbnail:   "/static/images/course-thumbnails/docker-containers.jpg",
 			Description: "Master Docker containerization. Learn images, volumes, networking, and multi-stage builds.",
+			Modules: []Module{
+				{Title: "Images", Description: "Build images and understand layers."},
+				{Title: "Volumes and Networking", Description: "Persist data and connect containers together."},
+				{Title: "Multi-Stage Builds", Description: "Produce small, production-ready images."},
+			},
 		},
 		{
 			ID:          "cloud-security",
@@ -78,6 +117,12 @@ func GetMockCourses() []Course {
 			Level:       "Advanced",
 			Thumbnail:   "/static/images/course-thumbnails/cloud-security.jpg",
 			Description: "Secure your cloud infrastructure. Learn IAM, encryption, network security, and compliance.",
+			Modules: []Module{
+				{Title: "Identity and Access", Description: "Apply least privilege with IAM roles and service accounts."},
+				{Title: "Encryption", Description: "Protect data at rest and in transit with Cloud KMS."},
+				{Title: "Network Security", Description: "Lock down traffic with firewall rules and private access."},
+				{Title: "Compliance", Description: "Audit activity with Cloud Audit Logs."},
+			},
 		},
 	}
 }
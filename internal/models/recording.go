@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Recording describes an asciicast recording of a terminal session. The
+// recording itself is stored on disk at Path, relative to the recordings directory.
+type Recording struct {
+	ID        string    `bson:"_id" json:"id"` // the terminal session ID
+	UserEmail string    `bson:"user_email" json:"user_email"`
+	CourseID  string    `bson:"course_id,omitempty" json:"course_id,omitempty"`
+	Path      string    `bson:"path" json:"-"`
+	SizeBytes int64     `bson:"size_bytes" json:"size_bytes"`
+	StartedAt time.Time `bson:"started_at" json:"started_at"`
+	EndedAt   time.Time `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+}
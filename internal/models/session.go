@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SessionRecord is a server-side login session. The browser cookie only
+// carries the signed session ID; the session values live in Data.
+type SessionRecord struct {
+	ID        string    `bson:"_id" json:"id"`
+	UserEmail string    `bson:"user_email,omitempty" json:"user_email,omitempty"`
+	Data      string    `bson:"data,omitempty" json:"-"`
+	UserAgent string    `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	IPAddress string    `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
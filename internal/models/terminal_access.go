@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Terminal access actions
+const (
+	TerminalAccessStart    = "start"    // the owner started a session
+	TerminalAccessReattach = "reattach" // the owner reattached to a detached session
+	TerminalAccessShare    = "share"    // the owner created a share link
+	TerminalAccessUnshare  = "unshare"  // sharing was stopped
+	TerminalAccessWatch    = "watch"    // someone else attached as a viewer
+)
+
+// TerminalAccessEvent is an audit record of someone attaching to, or
+// changing who may attach to, a terminal session
+type TerminalAccessEvent struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SessionID    string             `bson:"session_id" json:"session_id"`
+	SessionOwner string             `bson:"session_owner" json:"session_owner"`
+	ActorEmail   string             `bson:"actor_email" json:"actor_email"`
+	Action       string             `bson:"action" json:"action"`
+	Access       string             `bson:"access,omitempty" json:"access,omitempty"` // observe or control, for shares and viewers
+	Via          string             `bson:"via,omitempty" json:"via,omitempty"`       // "link" or "admin", for viewers
+	IPAddress    string             `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -12,5 +12,17 @@ type User struct {
 	DisplayName  string       `bson:"display_name"`
 	ProfilePic   string       `bson:"profile_pic"`
 	MemberSince  time.Time    `bson:"member_since"`
+	LastLogin    time.Time    `bson:"last_login"`
 	Settings     UserSettings `bson:"settings"`
 }
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// IsValidRole reports whether role is a known user role
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
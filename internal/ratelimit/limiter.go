@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter is an in-memory sliding-window rate limiter keyed by an arbitrary string
+type Limiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	hits      map[string][]time.Time
+	lastSweep time.Time
+}
+
+// New creates a limiter allowing limit events per key within each window
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+// AllowAll records one event against each key and reports whether every key
+// is within the limit. Rejected events are not recorded against any of the
+// keys, so a blocked caller is not locked out longer and one exhausted key
+// does not drain the others.
+func (l *Limiter) AllowAll(keys ...string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	// Periodically drop idle keys so one-off callers don't accumulate
+	if now.Sub(l.lastSweep) > l.window {
+		for k := range l.hits {
+			l.prune(k, now)
+		}
+		l.lastSweep = now
+	}
+
+	for _, key := range keys {
+		if len(l.prune(key, now)) >= l.limit {
+			return false
+		}
+	}
+
+	for _, key := range keys {
+		l.hits[key] = append(l.hits[key], now)
+	}
+	return true
+}
+
+// prune drops events for key that fall outside the window and returns the rest
+func (l *Limiter) prune(key string, now time.Time) []time.Time {
+	cutoff := now.Add(-l.window)
+	events := l.hits[key]
+
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	events = events[i:]
+
+	if len(events) == 0 {
+		delete(l.hits, key)
+		return nil
+	}
+	l.hits[key] = events
+	return events
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLimiterAllow verifies events are limited per key within the window
+func TestLimiterAllow(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := New(2, time.Hour)
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.AllowAll("a") || !limiter.AllowAll("a") {
+		t.Fatal("Expected first two events to be allowed")
+	}
+	if limiter.AllowAll("a") {
+		t.Error("Expected third event within the window to be rejected")
+	}
+	if !limiter.AllowAll("b") {
+		t.Error("Expected a different key to be allowed")
+	}
+
+	now = now.Add(time.Hour + time.Second)
+	if !limiter.AllowAll("a") {
+		t.Error("Expected event after the window to be allowed")
+	}
+}
+
+// TestLimiterAllowAll verifies a rejected key charges none of the others
+func TestLimiterAllowAll(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := New(2, time.Hour)
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.AllowAll("ip", "email:a") || !limiter.AllowAll("ip2", "email:a") {
+		t.Fatal("Expected first two events to be allowed")
+	}
+	if limiter.AllowAll("ip", "email:a") {
+		t.Error("Expected event over the email limit to be rejected")
+	}
+	if !limiter.AllowAll("ip", "email:b") {
+		t.Error("Expected the rejected event not to have charged the IP key")
+	}
+	if limiter.AllowAll("ip", "email:c") {
+		t.Error("Expected event over the IP limit to be rejected")
+	}
+	if !limiter.AllowAll("ip3", "email:c") {
+		t.Error("Expected the rejected event not to have charged the email key")
+	}
+}
@@ -0,0 +1,179 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Header is the first line of an asciicast v2 file
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder writes a terminal session in asciicast v2 format: a JSON header
+// line followed by one [time, type, data] event per line. Input events carry
+// only their timing, never what was typed, since that includes passwords
+// entered at prompts that do not echo. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	w       *bufio.Writer
+	closer  io.Closer
+	started time.Time
+	now     func() time.Time
+	written int64
+	err     error
+
+	// Trailing bytes of an incomplete UTF-8 sequence, held until the rest
+	// arrives so events stay valid JSON strings
+	pendingOutput []byte
+}
+
+// NewRecorder writes the asciicast header to w and returns a recorder for the
+// session's events. Closing the recorder closes w.
+func NewRecorder(w io.WriteCloser, title string, width, height int) (*Recorder, error) {
+	r := &Recorder{
+		w:       bufio.NewWriter(w),
+		closer:  w,
+		started: time.Now(),
+		now:     time.Now,
+	}
+
+	header, err := json.Marshal(Header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.started.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.writeLine(header); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Output records data written by the terminal
+func (r *Recorder) Output(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pendingOutput = r.event("o", r.pendingOutput, data)
+}
+
+// Input records that the user typed, with the data left out
+func (r *Recorder) Input(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent("i", "")
+}
+
+// Resize records a change of terminal size
+func (r *Recorder) Resize(cols, rows uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Size returns the number of bytes written so far
+func (r *Recorder) Size() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.written
+}
+
+// Close flushes the recording and closes the underlying writer
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.w.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+	if err := r.closer.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// event writes one event line for data, prefixed by any pending bytes from
+// the previous call, and returns the bytes of an incomplete trailing UTF-8
+// sequence to carry over
+func (r *Recorder) event(kind string, pending, data []byte) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	buf := append(pending, data...)
+	complete := completeUTF8(buf)
+	rest := append([]byte(nil), buf[complete:]...)
+	if complete == 0 {
+		return rest
+	}
+
+	r.writeEvent(kind, string(buf[:complete]))
+	return rest
+}
+
+// writeEvent writes one event line stamped with the time since the start
+func (r *Recorder) writeEvent(kind, data string) {
+	if r.err != nil {
+		return
+	}
+
+	elapsed := r.now().Sub(r.started).Seconds()
+	text, err := json.Marshal(data)
+	if err != nil {
+		r.err = err
+		return
+	}
+
+	line := make([]byte, 0, len(text)+32)
+	line = append(line, '[')
+	line = strconv.AppendFloat(line, elapsed, 'f', 6, 64)
+	line = append(line, ", \""+kind+"\", "...)
+	line = append(line, text...)
+	line = append(line, ']')
+	r.writeLine(line)
+}
+
+// writeLine writes a newline-terminated line, remembering the first error
+func (r *Recorder) writeLine(line []byte) error {
+	if r.err != nil {
+		return r.err
+	}
+	n, err := r.w.Write(append(line, '\n'))
+	r.written += int64(n)
+	if err != nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// completeUTF8 returns the length of the longest prefix of b that does not end
+// in the middle of a UTF-8 sequence
+func completeUTF8(b []byte) int {
+	// A sequence is at most 4 bytes, so only the last 3 can be a partial one
+	for i := len(b) - 1; i >= 0 && i >= len(b)-3; i-- {
+		if !utf8.RuneStart(b[i]) {
+			continue
+		}
+		if !utf8.FullRune(b[i:]) {
+			return i
+		}
+		break
+	}
+	return len(b)
+}
@@ -0,0 +1,90 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nopCloser struct{ *bytes.Buffer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestRecorderWritesAsciicastV2(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := NewRecorder(nopCloser{&buf}, "demo", 80, 24)
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+	start := rec.started
+	rec.now = func() time.Time { return start.Add(1500 * time.Millisecond) }
+
+	rec.Output([]byte("hello "))
+	// "é" split across two writes must not be mangled
+	rec.Output([]byte{0xc3})
+	rec.Output([]byte{0xa9})
+	rec.Input([]byte("ls\r"))
+	rec.Resize(120, 40)
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected header and 4 events, got %d lines:\n%s", len(lines), buf.String())
+	}
+
+	var header Header
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		t.Fatalf("Invalid header: %v", err)
+	}
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 {
+		t.Errorf("Unexpected header %+v", header)
+	}
+
+	want := []struct {
+		kind, data string
+	}{
+		{"o", "hello "},
+		{"o", "é"},
+		{"i", ""},
+		{"r", "120x40"},
+	}
+	for i, w := range want {
+		var event []interface{}
+		if err := json.Unmarshal([]byte(lines[i+1]), &event); err != nil {
+			t.Fatalf("Invalid event %q: %v", lines[i+1], err)
+		}
+		if event[0].(float64) != 1.5 || event[1] != w.kind || event[2] != w.data {
+			t.Errorf("Event %d = %v, want [1.5 %s %q]", i, event, w.kind, w.data)
+		}
+	}
+	if rec.Size() != int64(buf.Len()) {
+		t.Errorf("Size() = %d, want %d", rec.Size(), buf.Len())
+	}
+}
+
+func TestRecorderOmitsTypedInput(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := NewRecorder(nopCloser{&buf}, "demo", 80, 24)
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+
+	rec.Output([]byte("[sudo] password for student: "))
+	rec.Input([]byte("hunter2"))
+	rec.Input([]byte("\r"))
+	rec.Output([]byte("\r\n"))
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("Typed secret was written to the recording:\n%s", buf.String())
+	}
+	if n := strings.Count(buf.String(), `"i", ""`); n != 2 {
+		t.Errorf("Expected 2 blank input events, got %d:\n%s", n, buf.String())
+	}
+}
@@ -0,0 +1,81 @@
+package recording
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Recording policies
+const (
+	PolicyOff    = "off"    // never record
+	PolicyCourse = "course" // record sessions of courses that ask for it
+	PolicyAll    = "all"    // record every session
+)
+
+// unsafePathChars matches characters not allowed in recording directory names
+var unsafePathChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// Store keeps recordings on disk, one directory per user and one file per
+// terminal session
+type Store struct {
+	Dir    string
+	Policy string
+}
+
+// NewStore creates a store rooted at dir, applying policy to decide which
+// sessions are recorded
+func NewStore(dir, policy string) (*Store, error) {
+	switch policy {
+	case PolicyOff, PolicyCourse, PolicyAll:
+	default:
+		return nil, fmt.Errorf("unknown recording policy %q (want off, course or all)", policy)
+	}
+	return &Store{Dir: dir, Policy: policy}, nil
+}
+
+// Enabled reports whether a session should be recorded. courseRequests is
+// true when the session's course asks for recording.
+func (s *Store) Enabled(courseRequests bool) bool {
+	switch s.Policy {
+	case PolicyAll:
+		return true
+	case PolicyCourse:
+		return courseRequests
+	default:
+		return false
+	}
+}
+
+// Create starts a recording file for a session and returns the recorder and
+// the file's path relative to the store
+func (s *Store) Create(userEmail, sessionID, title string) (*Recorder, string, error) {
+	rel := filepath.Join(unsafePathChars.ReplaceAllString(userEmail, "_"), sessionID+".cast")
+	path := filepath.Join(s.Dir, rel)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, "", fmt.Errorf("failed to create recording directory: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create recording file: %v", err)
+	}
+
+	recorder, err := NewRecorder(f, title, 80, 24)
+	if err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	return recorder, rel, nil
+}
+
+// Open opens a recording by its path relative to the store
+func (s *Store) Open(rel string) (*os.File, error) {
+	clean := filepath.Clean(rel)
+	if filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return nil, fmt.Errorf("invalid recording path %q", rel)
+	}
+	return os.Open(filepath.Join(s.Dir, clean))
+}
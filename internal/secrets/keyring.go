@@ -0,0 +1,183 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// keySize is the length in bytes of both key-encryption and data-encryption keys (AES-256)
+const keySize = 32
+
+// ErrUnknownKey is returned when data was sealed with a key the keyring does not hold
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Keyring holds versioned key-encryption keys (KEKs) for envelope encryption.
+// New data is always sealed with the primary key; older keys are kept so data
+// sealed before a rotation can still be opened and re-encrypted.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// ParseKeyring builds a keyring from a comma-separated list of id:base64key
+// pairs, e.g. "v1:AAAA...,v2:BBBB...". If primaryID is empty the last key
+// listed becomes the primary.
+func ParseKeyring(spec, primaryID string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+	var last string
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key entry %q: expected id:base64key", entry)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64: %v", id, err)
+		}
+		keys[id] = key
+		last = id
+	}
+
+	if primaryID == "" {
+		primaryID = last
+	}
+	return NewKeyring(keys, primaryID)
+}
+
+// NewKeyring builds a keyring from raw 32-byte keys indexed by key ID
+func NewKeyring(keys map[string][]byte, primaryID string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption keys configured")
+	}
+
+	k := &Keyring{
+		primary: primaryID,
+		keys:    make(map[string]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", id, err)
+		}
+		k.keys[id] = aead
+	}
+
+	if _, ok := k.keys[primaryID]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primaryID)
+	}
+
+	return k, nil
+}
+
+// PrimaryKeyID returns the ID of the key used for new encryptions
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primary
+}
+
+// Encrypt seals each plaintext under a fresh data key, which is itself sealed
+// with the primary key. aad binds the ciphertexts to their context (such as
+// the owning document ID) so they cannot be swapped between records.
+func (k *Keyring) Encrypt(aad string, plaintexts ...string) (keyID string, wrappedKey []byte, ciphertexts [][]byte, err error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to generate data key: %v", err)
+	}
+
+	dataAEAD, err := newAEAD(dek)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	ciphertexts = make([][]byte, len(plaintexts))
+	for i, plaintext := range plaintexts {
+		ciphertexts[i], err = seal(dataAEAD, []byte(plaintext), fieldAAD(aad, i))
+		if err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	wrappedKey, err = seal(k.keys[k.primary], dek, []byte(aad))
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	return k.primary, wrappedKey, ciphertexts, nil
+}
+
+// Decrypt opens ciphertexts produced by Encrypt
+func (k *Keyring) Decrypt(keyID string, wrappedKey []byte, aad string, ciphertexts ...[]byte) ([]string, error) {
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+
+	dek, err := open(kek, wrappedKey, []byte(aad))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %v", err)
+	}
+
+	dataAEAD, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintexts := make([]string, len(ciphertexts))
+	for i, ciphertext := range ciphertexts {
+		plaintext, err := open(dataAEAD, ciphertext, fieldAAD(aad, i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt field %d: %v", i, err)
+		}
+		plaintexts[i] = string(plaintext)
+	}
+
+	return plaintexts, nil
+}
+
+// newAEAD creates an AES-256-GCM cipher for key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext, prefixing the output with a random nonce
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open reverses seal
+func open(aead cipher.AEAD, ciphertext, aad []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, aad)
+}
+
+// fieldAAD binds a ciphertext to both the record context and its position
+func fieldAAD(aad string, index int) []byte {
+	return []byte(aad + "\x00" + strconv.Itoa(index))
+}
@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keySize))
+}
+
+// TestEncryptDecryptRoundTrip verifies sealed fields open with the same context
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	keyring, err := ParseKeyring("v1:"+testKey(1), "")
+	if err != nil {
+		t.Fatalf("Failed to parse keyring: %v", err)
+	}
+
+	keyID, wrapped, ciphertexts, err := keyring.Encrypt("user@example.com", "access", "refresh")
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if keyID != "v1" {
+		t.Errorf("Expected key ID v1, got %s", keyID)
+	}
+	if bytes.Contains(ciphertexts[0], []byte("access")) {
+		t.Error("Expected ciphertext not to contain the plaintext")
+	}
+
+	plaintexts, err := keyring.Decrypt(keyID, wrapped, "user@example.com", ciphertexts...)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if plaintexts[0] != "access" || plaintexts[1] != "refresh" {
+		t.Errorf("Expected [access refresh], got %v", plaintexts)
+	}
+
+	// Ciphertexts are bound to their record and position
+	if _, err := keyring.Decrypt(keyID, wrapped, "other@example.com", ciphertexts...); err == nil {
+		t.Error("Expected decrypt with a different context to fail")
+	}
+	if _, err := keyring.Decrypt(keyID, wrapped, "user@example.com", ciphertexts[1], ciphertexts[0]); err == nil {
+		t.Error("Expected decrypt with swapped fields to fail")
+	}
+}
+
+// TestKeyRotation verifies data sealed with an old key still opens after rotation
+func TestKeyRotation(t *testing.T) {
+	oldRing, _ := ParseKeyring("v1:"+testKey(1), "")
+	keyID, wrapped, ciphertexts, err := oldRing.Encrypt("ctx", "secret")
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	rotated, err := ParseKeyring("v1:"+testKey(1)+",v2:"+testKey(2), "")
+	if err != nil {
+		t.Fatalf("Failed to parse keyring: %v", err)
+	}
+	if rotated.PrimaryKeyID() != "v2" {
+		t.Errorf("Expected last key to be primary, got %s", rotated.PrimaryKeyID())
+	}
+
+	plaintexts, err := rotated.Decrypt(keyID, wrapped, "ctx", ciphertexts...)
+	if err != nil || plaintexts[0] != "secret" {
+		t.Errorf("Expected old data to decrypt after rotation, got %v, %v", plaintexts, err)
+	}
+
+	retired, _ := ParseKeyring("v2:"+testKey(2), "")
+	if _, err := retired.Decrypt(keyID, wrapped, "ctx", ciphertexts...); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey for a retired key, got %v", err)
+	}
+}
+
+// TestParseKeyringErrors verifies malformed key specs are rejected
+func TestParseKeyringErrors(t *testing.T) {
+	tests := []struct {
+		spec    string
+		primary string
+	}{
+		{"", ""},
+		{"nokey", ""},
+		{"v1:not-base64!", ""},
+		{"v1:" + base64.StdEncoding.EncodeToString([]byte("short")), ""},
+		{"v1:" + testKey(1) + ",v1:" + testKey(2), ""},
+		{"v1:" + testKey(1), "v9"},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseKeyring(tt.spec, tt.primary); err == nil {
+			t.Errorf("Expected error for spec %q primary %q", tt.spec, tt.primary)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"supreme-broccoli/internal/models"
+)
+
+// Backend names used in configuration and on courses
+const (
+	BackendCloudShell = "cloudshell"
+	BackendLocal      = "local"
+	BackendDocker     = "docker"
+	BackendSSH        = "ssh"
+)
+
+// Launch describes the terminal session a backend is starting a process for
+type Launch struct {
+	SessionID string
+	User      models.User
+	CourseID  string
+	// EditorPort is the local port reserved for the session's editor
+	// forward, for backends implementing PortForwarder
+	EditorPort int
+	// PreviewPorts maps ports lab apps may listen on in the session's
+	// environment to the local ports reserved for forwarding them
+	PreviewPorts map[int]int
+}
+
+// Backend starts the process a terminal session runs in its PTY
+type Backend interface {
+	// Name identifies the backend in configuration and course settings
+	Name() string
+
+	// RequiresGoogleToken reports whether Command needs a fresh OAuth access
+	// token in Launch.User
+	RequiresGoogleToken() bool
+
+	// Command builds the process to run for the session. The caller starts it
+	// in a PTY.
+	Command(launch Launch) (*exec.Cmd, error)
+}
+
+// Cleaner is implemented by backends whose sessions leave something behind
+// that killing the local process does not release
+type Cleaner interface {
+	// Cleanup releases what a session left behind once its process has ended
+	Cleanup(launch Launch) error
+}
+
+// PortForwarder is implemented by backends that forward web servers running
+// in the session's environment to this server: the editor to
+// Launch.EditorPort and lab apps to Launch.PreviewPorts
+type PortForwarder interface {
+	// RemoteEditorPort is the port the editor listens on in the session's
+	// environment
+	RemoteEditorPort() int
+	// RemotePreviewPorts are the ports lab apps may be previewed on
+	RemotePreviewPorts() []int
+}
+
+// Backends holds the configured backends and which one is used by default
+type Backends struct {
+	byName      map[string]Backend
+	defaultName string
+}
+
+// NewBackends registers backends and selects defaultName as the default.
+// It fails if the default is not among them.
+func NewBackends(defaultName string, backends ...Backend) (*Backends, error) {
+	b := &Backends{
+		byName:      make(map[string]Backend, len(backends)),
+		defaultName: defaultName,
+	}
+	for _, backend := range backends {
+		b.byName[backend.Name()] = backend
+	}
+	if _, ok := b.byName[defaultName]; !ok {
+		return nil, fmt.Errorf("terminal backend %q is not configured (available: %s)",
+			defaultName, strings.Join(b.Names(), ", "))
+	}
+	return b, nil
+}
+
+// Get returns the named backend, or the default when name is empty
+func (b *Backends) Get(name string) (Backend, error) {
+	if name == "" {
+		name = b.defaultName
+	}
+	backend, ok := b.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("terminal backend %q is not configured", name)
+	}
+	return backend, nil
+}
+
+// Default returns the name of the default backend
+func (b *Backends) Default() string {
+	return b.defaultName
+}
+
+// Names lists the configured backends in alphabetical order
+func (b *Backends) Names() []string {
+	names := make([]string, 0, len(b.byName))
+	for name := range b.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CloudShellBackend opens the user's Google Cloud Shell with gcloud, forwarding
+// the Theia editor and preview ports back to this server
+type CloudShellBackend struct {
+	// EditorPort is the port Theia listens on inside Cloud Shell
+	EditorPort int
+	// PreviewPorts are the ports inside Cloud Shell that users may preview
+	PreviewPorts []int
+}
+
+// Name implements Backend
+func (b *CloudShellBackend) Name() string { return BackendCloudShell }
+
+// RequiresGoogleToken implements Backend
+func (b *CloudShellBackend) RequiresGoogleToken() bool { return true }
+
+// RemoteEditorPort implements PortForwarder
+func (b *CloudShellBackend) RemoteEditorPort() int { return b.EditorPort }
+
+// RemotePreviewPorts implements PortForwarder
+func (b *CloudShellBackend) RemotePreviewPorts() []int { return b.PreviewPorts }
+
+// Command implements Backend
+func (b *CloudShellBackend) Command(launch Launch) (*exec.Cmd, error) {
+	if launch.User.AccessToken == "" {
+		return nil, fmt.Errorf("no access token for %s", launch.User.Email)
+	}
+
+	args := []string{"cloud-shell", "ssh", "--authorize-session", "--quiet"}
+	if launch.EditorPort != 0 && b.EditorPort != 0 {
+		args = append(args, forwardFlag(launch.EditorPort, b.EditorPort))
+	}
+	for _, remote := range b.PreviewPorts {
+		if local := launch.PreviewPorts[remote]; local != 0 {
+			args = append(args, forwardFlag(local, remote))
+		}
+	}
+	cmd := exec.Command("gcloud", args...)
+	cmd.Env = childEnv("CLOUDSDK_AUTH_ACCESS_TOKEN=" + launch.User.AccessToken)
+	return cmd, nil
+}
+
+// forwardFlag asks gcloud's ssh to forward a local port to a port in Cloud Shell
+func forwardFlag(local, remote int) string {
+	return fmt.Sprintf("--ssh-flag=-L %d:localhost:%d", local, remote)
+}
+
+// LocalShellBackend runs a shell on this server. It is meant for development
+// and offline testing; every user shares the server's account.
+type LocalShellBackend struct {
+	Shell string
+	Dir   string
+}
+
+// Name implements Backend
+func (b *LocalShellBackend) Name() string { return BackendLocal }
+
+// RequiresGoogleToken implements Backend
+func (b *LocalShellBackend) RequiresGoogleToken() bool { return false }
+
+// Command implements Backend
+func (b *LocalShellBackend) Command(launch Launch) (*exec.Cmd, error) {
+	shell := b.Shell
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	cmd := exec.Command(shell)
+	cmd.Dir = b.Dir
+	cmd.Env = childEnv()
+	return cmd, nil
+}
+
+// DockerBackend runs each session in a fresh, disposable container
+type DockerBackend struct {
+	Image  string
+	Shell  string
+	Memory string // passed to --memory when set, e.g. "512m"
+	CPUs   string // passed to --cpus when set, e.g. "1"
+}
+
+// Name implements Backend
+func (b *DockerBackend) Name() string { return BackendDocker }
+
+// RequiresGoogleToken implements Backend
+func (b *DockerBackend) RequiresGoogleToken() bool { return false }
+
+// Command implements Backend
+func (b *DockerBackend) Command(launch Launch) (*exec.Cmd, error) {
+	if b.Image == "" {
+		return nil, fmt.Errorf("no docker image configured")
+	}
+	shell := b.Shell
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	args := []string{"run", "--rm", "-i", "-t", "--init",
+		"--name", ContainerName(launch.SessionID),
+		"--label", "cloudlab.user=" + launch.User.Email,
+	}
+	if launch.CourseID != "" {
+		args = append(args, "--label", "cloudlab.course="+launch.CourseID)
+	}
+	if b.Memory != "" {
+		args = append(args, "--memory", b.Memory)
+	}
+	if b.CPUs != "" {
+		args = append(args, "--cpus", b.CPUs)
+	}
+	args = append(args, b.Image, shell)
+
+	return dockerCommand(args...), nil
+}
+
+// Cleanup implements Cleaner. Killing the docker client does not stop the
+// container, so it is removed by name.
+func (b *DockerBackend) Cleanup(launch Launch) error {
+	out, err := dockerCommand("rm", "-f", ContainerName(launch.SessionID)).CombinedOutput()
+	if err != nil && !strings.Contains(string(out), "No such container") {
+		return fmt.Errorf("failed to remove container %s: %v: %s", ContainerName(launch.SessionID), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// dockerCommand runs the docker client, which needs DOCKER_HOST when the
+// daemon is not on the default socket
+func dockerCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command("docker", args...)
+	cmd.Env = childEnv(passEnv("DOCKER_HOST")...)
+	return cmd
+}
+
+// ContainerName is the docker container name used for a terminal session
+func ContainerName(sessionID string) string {
+	return "cloudlab-" + sessionID
+}
+
+// SSHBackend connects to a fixed lab host over SSH
+type SSHBackend struct {
+	Host         string
+	Port         int
+	User         string
+	IdentityFile string
+	// KnownHostsFile pins the host key; host keys are always checked strictly
+	KnownHostsFile string
+}
+
+// Name implements Backend
+func (b *SSHBackend) Name() string { return BackendSSH }
+
+// RequiresGoogleToken implements Backend
+func (b *SSHBackend) RequiresGoogleToken() bool { return false }
+
+// Command implements Backend
+func (b *SSHBackend) Command(launch Launch) (*exec.Cmd, error) {
+	if b.Host == "" {
+		return nil, fmt.Errorf("no ssh host configured")
+	}
+	return sshCommand(append([]string{"-tt"}, b.args()...)...), nil
+}
+
+// sshCommand runs the ssh client, which needs SSH_AUTH_SOCK to use an agent
+func sshCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command("ssh", args...)
+	cmd.Env = childEnv(passEnv("SSH_AUTH_SOCK")...)
+	return cmd
+}
+
+// args returns the ssh options and destination shared by the terminal and
+// file transfers
+func (b *SSHBackend) args() []string {
+	args := []string{"-o", "StrictHostKeyChecking=yes", "-o", "BatchMode=yes"}
+	if b.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(b.Port))
+	}
+	if b.IdentityFile != "" {
+		args = append(args, "-i", b.IdentityFile)
+	}
+	if b.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+b.KnownHostsFile)
+	}
+
+	target := b.Host
+	if b.User != "" {
+		target = b.User + "@" + b.Host
+	}
+	return append(args, target)
+}
+
+// childEnv returns the environment for a backend process: PATH, HOME and
+// LANG from the server, TERM for the browser terminal, and extra. Nothing
+// else is passed on, since the server's environment holds its OAuth client
+// secret, session and token keys and database credentials.
+func childEnv(extra ...string) []string {
+	env := append([]string{"TERM=xterm-256color"}, passEnv("PATH", "HOME", "LANG")...)
+	return append(env, extra...)
+}
+
+// passEnv returns the server's values of the given variables that are set
+func passEnv(keys ...string) []string {
+	var env []string
+	for _, key := range keys {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
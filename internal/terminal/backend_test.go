@@ -0,0 +1,37 @@
+package terminal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLocalShellEnvOmitsServerSecrets(t *testing.T) {
+	t.Setenv("GOOGLE_CLIENT_SECRET", "client-secret")
+	t.Setenv("SESSION_KEY", "session-key")
+	t.Setenv("DB_DSN", "mongodb://user:pass@db")
+	t.Setenv("LANG", "C.UTF-8")
+
+	cmd, err := (&LocalShellBackend{Shell: "/bin/sh"}).Command(Launch{})
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+
+	vars := map[string]string{}
+	for _, kv := range cmd.Env {
+		key, value, _ := strings.Cut(kv, "=")
+		vars[key] = value
+	}
+	for _, key := range []string{"GOOGLE_CLIENT_SECRET", "SESSION_KEY", "DB_DSN"} {
+		if _, ok := vars[key]; ok {
+			t.Errorf("Expected %s to be left out of the shell's environment", key)
+		}
+	}
+	for key, want := range map[string]string{"TERM": "xterm-256color", "LANG": "C.UTF-8"} {
+		if vars[key] != want {
+			t.Errorf("Expected %s=%s, got %q", key, want, vars[key])
+		}
+	}
+	if len(cmd.Env) > 4 {
+		t.Errorf("Expected only PATH, HOME, LANG and TERM, got %v", cmd.Env)
+	}
+}
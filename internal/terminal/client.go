@@ -0,0 +1,218 @@
+package terminal
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Connection tuning for terminal sockets
+const (
+	writeWait      = 10 * time.Second  // time allowed to write one frame
+	pongWait       = 60 * time.Second  // time allowed between frames from the client
+	pingPeriod     = pongWait * 9 / 10 // how often the server pings; must be less than pongWait
+	maxMessageSize = 1 << 20           // largest frame accepted from the client, e.g. a paste
+	maxOutputFrame = 32 * 1024         // queued output is coalesced into frames up to this size
+	outputWindow   = 256 * 1024        // output bytes queued for a client before flow control applies
+)
+
+// outboundFrame is a WebSocket frame waiting to be written
+type outboundFrame struct {
+	messageType int
+	data        []byte
+}
+
+// socketClient is one WebSocket connection to a session. Frames are queued
+// and written by a single goroutine with write deadlines, so a slow client
+// never blocks the PTY reader, and consecutive output is coalesced into
+// larger frames while the client catches up. The client is pinged
+// periodically and dropped if it stops answering.
+type socketClient struct {
+	conn *websocket.Conn
+
+	mu      sync.Mutex
+	room    *sync.Cond // signalled when queued output drains or the client closes
+	queue   []outboundFrame
+	pending int  // output bytes queued
+	closing bool // a close frame is queued; nothing more is accepted
+	closed  bool
+
+	wake chan struct{}
+	quit chan struct{}
+	done chan struct{} // closed once the writer has finished with the connection
+}
+
+// newSocketClient sets up keepalive on conn and starts its writer
+func newSocketClient(conn *websocket.Conn) *socketClient {
+	c := &socketClient{
+		conn: conn,
+		wake: make(chan struct{}, 1),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	c.room = sync.NewCond(&c.mu)
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	go c.writeLoop()
+	return c
+}
+
+// ReadMessage reads the next frame from the client, extending the read
+// deadline on success
+func (c *socketClient) ReadMessage() (int, []byte, error) {
+	msgType, data, err := c.conn.ReadMessage()
+	if err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	}
+	return msgType, data, err
+}
+
+// SendJSON queues a control message
+func (c *socketClient) SendJSON(msg ControlMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	c.enqueue(outboundFrame{messageType: websocket.TextMessage, data: data})
+}
+
+// SendOutput queues terminal output, merging it into the last queued output
+// frame when there is room. It reports false when the client has more than
+// the flow-control window queued.
+func (c *socketClient) SendOutput(data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing || c.closed {
+		return true
+	}
+
+	if n := len(c.queue); n > 0 && c.queue[n-1].messageType == websocket.BinaryMessage &&
+		len(c.queue[n-1].data)+len(data) <= maxOutputFrame {
+		c.queue[n-1].data = append(c.queue[n-1].data, data...)
+	} else {
+		c.queue = append(c.queue, outboundFrame{messageType: websocket.BinaryMessage, data: append([]byte(nil), data...)})
+	}
+	c.pending += len(data)
+	c.signal()
+	return c.pending <= outputWindow
+}
+
+// WaitForRoom blocks while the client has more than the flow-control window
+// of output queued, so a slow client slows the session down instead of
+// buffering without bound
+func (c *socketClient) WaitForRoom() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.pending > outputWindow && !c.closed {
+		c.room.Wait()
+	}
+}
+
+// CloseWith queues a close frame with the given status code after any
+// pending frames, then closes the connection
+func (c *socketClient) CloseWith(code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing || c.closed {
+		return
+	}
+	c.queue = append(c.queue, outboundFrame{messageType: websocket.CloseMessage, data: websocket.FormatCloseMessage(code, reason)})
+	c.closing = true
+	c.signal()
+}
+
+// Close drops the connection immediately
+func (c *socketClient) Close() {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.quit)
+		c.room.Broadcast()
+	}
+	c.mu.Unlock()
+	c.conn.Close()
+}
+
+// Wait blocks until the writer has finished with the connection
+func (c *socketClient) Wait() {
+	<-c.done
+}
+
+// enqueue adds a frame to the queue and wakes the writer
+func (c *socketClient) enqueue(frame outboundFrame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing || c.closed {
+		return
+	}
+	c.queue = append(c.queue, frame)
+	c.signal()
+}
+
+// signal wakes the writer without blocking. c.mu must be held.
+func (c *socketClient) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next pops the oldest queued frame
+func (c *socketClient) next() (outboundFrame, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) == 0 || c.closed {
+		return outboundFrame{}, false
+	}
+	frame := c.queue[0]
+	c.queue[0] = outboundFrame{}
+	c.queue = c.queue[1:]
+	if frame.messageType == websocket.BinaryMessage {
+		c.pending -= len(frame.data)
+		c.room.Broadcast()
+	}
+	return frame, true
+}
+
+// writeLoop writes queued frames and pings until the connection fails, a
+// close frame has been sent or the client is closed
+func (c *socketClient) writeLoop() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Close()
+		close(c.done)
+	}()
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		case <-c.wake:
+			for {
+				frame, ok := c.next()
+				if !ok {
+					break
+				}
+				c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := c.conn.WriteMessage(frame.messageType, frame.data); err != nil {
+					return
+				}
+				if frame.messageType == websocket.CloseMessage {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,828 @@
+package terminal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/gorilla/websocket"
+)
+
+// Defaults for how long a detached session is kept and how much output it
+// retains for replay
+const (
+	DefaultDetachGrace = 5 * time.Minute
+	DefaultScrollback  = 256 * 1024
+	DefaultWarnBefore  = 2 * time.Minute
+)
+
+// Errors returned when starting a session would exceed the manager's limits
+var (
+	ErrUserSessionLimit = errors.New("too many terminal sessions for this user")
+	ErrSessionLimit     = errors.New("too many terminal sessions on this server")
+)
+
+// Limits bounds how many sessions run and for how long. Zero values disable
+// the corresponding limit.
+type Limits struct {
+	MaxPerUser  int           // running sessions per user
+	MaxTotal    int           // running sessions on this server
+	IdleTimeout time.Duration // time since the last keystroke
+	MaxDuration time.Duration // time since the session started
+	// WarnBefore is how long before an idle or duration cutoff the session's
+	// clients are warned
+	WarnBefore time.Duration
+}
+
+// Reasons a session was ended by the server, sent with MessageExit
+const (
+	ExitIdle     = "Session closed after being idle for too long."
+	ExitDuration = "Session closed after reaching the maximum session length."
+)
+
+// Session describes a terminal session running on this server
+type Session struct {
+	ID         string
+	UserEmail  string
+	CourseID   string
+	Backend    string
+	RemoteAddr string
+	StartedAt  time.Time
+	Recording  bool
+	EditorPort int // local port the session's editor is forwarded to, if any
+	// PreviewPorts maps preview ports in the session's environment to the
+	// local ports they are forwarded to
+	PreviewPorts map[int]int
+	Attached     bool
+	Viewers      []Viewer
+}
+
+// Access levels for viewers of a shared session
+const (
+	AccessObserve = "observe" // sees the output only
+	AccessControl = "control" // may also type and send signals
+)
+
+// Viewer is someone other than the owner watching a session
+type Viewer struct {
+	Email  string
+	Access string
+}
+
+// CanType reports whether the viewer's input reaches the session
+func (v Viewer) CanType() bool {
+	return v.Access == AccessControl
+}
+
+// Tap observes the traffic of a session, e.g. to record it. Taps must be
+// safe for concurrent use.
+type Tap interface {
+	Output(data []byte)
+	Input(data []byte)
+	Resize(cols, rows uint16)
+	Close() error
+}
+
+// StartOptions configures a new session
+type StartOptions struct {
+	// OnExit, if set, is called once the session's process has ended
+	OnExit func(*LiveSession)
+	// Taps see all output, input and resizes, and are closed when the session ends
+	Taps []Tap
+	// Cleanup, if set, is called after the process has ended to release
+	// anything it leaves behind outside its process group, e.g. a container
+	Cleanup func()
+}
+
+// Manager owns the terminal processes running on this server. A session
+// outlives its WebSocket connection for a grace period, so a client can
+// reattach after a page refresh or network drop and have recent output
+// replayed.
+type Manager struct {
+	grace      time.Duration
+	scrollback int
+	limits     Limits
+
+	mu       sync.RWMutex
+	sessions map[string]*LiveSession
+	shares   map[string]shareGrant // share token → grant
+}
+
+// shareGrant is what a share link gives access to
+type shareGrant struct {
+	session *LiveSession
+	access  string
+}
+
+// NewManager creates a manager that keeps detached sessions alive for grace,
+// retains scrollback bytes of output per session and enforces limits
+func NewManager(grace time.Duration, scrollback int, limits Limits) *Manager {
+	return &Manager{
+		grace:      grace,
+		scrollback: scrollback,
+		limits:     limits,
+		sessions:   make(map[string]*LiveSession),
+		shares:     make(map[string]shareGrant),
+	}
+}
+
+// Admit reports whether a new session for email would be within the
+// manager's concurrency limits. Start checks again, so this is only to
+// fail early.
+func (m *Manager) Admit(email string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.admit(email)
+}
+
+// admit checks the concurrency limits. m.mu must be held.
+func (m *Manager) admit(email string) error {
+	if m.limits.MaxTotal > 0 && len(m.sessions) >= m.limits.MaxTotal {
+		return ErrSessionLimit
+	}
+	if m.limits.MaxPerUser > 0 {
+		count := 0
+		for _, s := range m.sessions {
+			if s.info.UserEmail == email {
+				count++
+			}
+		}
+		if count >= m.limits.MaxPerUser {
+			return ErrUserSessionLimit
+		}
+	}
+	return nil
+}
+
+// Start runs cmd in a new PTY and registers it under info.ID. It fails with
+// ErrUserSessionLimit or ErrSessionLimit when the limits are reached.
+func (m *Manager) Start(info Session, cmd *exec.Cmd, opts StartOptions) (*LiveSession, error) {
+	if info.StartedAt.IsZero() {
+		info.StartedAt = time.Now()
+	}
+
+	// Hold the lock while starting so concurrent starts can't overshoot
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.admit(info.UserEmail); err != nil {
+		return nil, err
+	}
+
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &LiveSession{
+		info:       info,
+		manager:    m,
+		cmd:        cmd,
+		ptmx:       ptmx,
+		scrollback: NewRingBuffer(m.scrollback),
+		onExit:     opts.OnExit,
+		cleanup:    opts.Cleanup,
+		taps:       opts.Taps,
+		viewers:    make(map[*socketClient]Viewer),
+		lastInput:  info.StartedAt,
+		done:       make(chan struct{}),
+	}
+	m.sessions[info.ID] = s
+
+	// Output is consumed even while no client is attached so the process never
+	// blocks on a full PTY
+	go s.pump()
+	if m.limits.IdleTimeout > 0 || m.limits.MaxDuration > 0 {
+		go s.watchdog(m.limits)
+	}
+	return s, nil
+}
+
+// Get returns a running session by ID
+func (m *Manager) Get(id string) (*LiveSession, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+// List returns a snapshot of running sessions, oldest first
+func (m *Manager) List() []Session {
+	m.mu.RLock()
+	live := make([]*LiveSession, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		live = append(live, s)
+	}
+	m.mu.RUnlock()
+
+	sessions := make([]Session, 0, len(live))
+	for _, s := range live {
+		sessions = append(sessions, s.Info())
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.Before(sessions[j].StartedAt)
+	})
+
+	return sessions
+}
+
+// EditorPort returns the local editor port of the user's most recently
+// started session that forwards one
+func (m *Manager) EditorPort(email string) (int, bool) {
+	return m.newestPort(email, func(info *Session) int { return info.EditorPort })
+}
+
+// PreviewPort returns the local port that remote, a preview port in the
+// session's environment, is forwarded to by the user's most recently started
+// session that forwards it
+func (m *Manager) PreviewPort(email string, remote int) (int, bool) {
+	return m.newestPort(email, func(info *Session) int { return info.PreviewPorts[remote] })
+}
+
+// newestPort returns the non-zero port picked from the user's most recently
+// started session that has one
+func (m *Manager) newestPort(email string, pick func(*Session) int) (int, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var newest *Session
+	port := 0
+	for _, s := range m.sessions {
+		info := &s.info
+		if info.UserEmail != email || pick(info) == 0 {
+			continue
+		}
+		if newest == nil || info.StartedAt.After(newest.StartedAt) {
+			newest, port = info, pick(info)
+		}
+	}
+	return port, newest != nil
+}
+
+// Share creates a share token granting access to a running session. The
+// token is valid until the session ends or sharing is stopped.
+func (m *Manager) Share(id, access string) (string, error) {
+	if access != AccessObserve && access != AccessControl {
+		return "", fmt.Errorf("invalid access level %q", access)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return "", fmt.Errorf("terminal session %s is not running", id)
+	}
+	token := NewSessionID()
+	m.shares[token] = shareGrant{session: s, access: access}
+	return token, nil
+}
+
+// Redeem looks up the session and access level a share token grants
+func (m *Manager) Redeem(token string) (*LiveSession, string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	grant, ok := m.shares[token]
+	if !ok {
+		return nil, "", false
+	}
+	return grant.session, grant.access, true
+}
+
+// Unshare invalidates every share token for a session and disconnects its
+// viewers
+func (m *Manager) Unshare(id string) {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	m.dropShares(id)
+	m.mu.Unlock()
+
+	if ok {
+		s.disconnectViewers()
+	}
+}
+
+// remove unregisters a session once its process has ended
+func (m *Manager) remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	m.dropShares(id)
+}
+
+// dropShares deletes the share tokens of a session. m.mu must be held.
+func (m *Manager) dropShares(id string) {
+	for token, grant := range m.shares {
+		if grant.session.info.ID == id {
+			delete(m.shares, token)
+		}
+	}
+}
+
+// LiveSession is a running terminal process, the owner's client attached to
+// it and any viewers it has been shared with
+type LiveSession struct {
+	info    Session
+	manager *Manager
+	cmd     *exec.Cmd
+	ptmx    *os.File
+	onExit  func(*LiveSession)
+	cleanup func()
+	taps    []Tap
+	done    chan struct{}
+
+	mu          sync.Mutex
+	scrollback  *RingBuffer
+	client      *socketClient
+	viewers     map[*socketClient]Viewer
+	detachTimer *time.Timer
+	exited      bool
+	lastInput   time.Time
+	warnedFor   time.Time // the cutoff clients were last warned about
+	exitReason  string
+}
+
+// Info returns a snapshot of the session's details
+func (s *LiveSession) Info() Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := s.info
+	info.Attached = s.client != nil
+	for _, viewer := range s.viewers {
+		info.Viewers = append(info.Viewers, viewer)
+	}
+	sort.Slice(info.Viewers, func(i, j int) bool {
+		return info.Viewers[i].Email < info.Viewers[j].Email
+	})
+	return info
+}
+
+// Done is closed once the session's process has ended
+func (s *LiveSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Attach connects conn to the session, replaying buffered output first, and
+// blocks until the client disconnects or the session ends. A client already
+// attached is disconnected. When the last client leaves, the session is kept
+// for the manager's grace period before being terminated.
+func (s *LiveSession) Attach(conn *websocket.Conn, resumed bool) {
+	client := newSocketClient(conn)
+	defer client.Wait()
+
+	s.mu.Lock()
+	if s.exited {
+		s.mu.Unlock()
+		client.SendJSON(ControlMessage{Type: MessageExit})
+		client.CloseWith(websocket.CloseNormalClosure, "session has ended")
+		return
+	}
+	if s.client != nil {
+		s.client.SendJSON(ControlMessage{Type: MessageTakenOver})
+		s.client.CloseWith(websocket.CloseNormalClosure, "opened in another window")
+	}
+	if s.detachTimer != nil {
+		s.detachTimer.Stop()
+		s.detachTimer = nil
+	}
+	s.client = client
+
+	// Replay under the lock so no live output slips in before it
+	client.SendJSON(ControlMessage{Type: MessageSession, Session: s.info.ID, Resumed: resumed, Recording: s.info.Recording})
+	if replay := s.scrollback.Bytes(); resumed && len(replay) > 0 {
+		client.SendOutput(replay)
+	}
+	if len(s.viewers) > 0 {
+		client.SendJSON(s.viewersMessage())
+	}
+	s.mu.Unlock()
+
+	s.readInput(client, nil)
+	s.detach(client)
+	client.Close()
+}
+
+// Watch connects conn to the session as a viewer, replaying buffered output
+// first, and blocks until the viewer disconnects or the session ends.
+// Viewers do not keep a detached session alive, and only viewers with
+// control access can type into it. The owner is told who is watching.
+func (s *LiveSession) Watch(conn *websocket.Conn, viewer Viewer) {
+	client := newSocketClient(conn)
+	defer client.Wait()
+
+	s.mu.Lock()
+	if s.exited {
+		s.mu.Unlock()
+		client.SendJSON(ControlMessage{Type: MessageExit})
+		client.CloseWith(websocket.CloseNormalClosure, "session has ended")
+		return
+	}
+	s.viewers[client] = viewer
+	client.SendJSON(ControlMessage{Type: MessageSession, Resumed: true, Recording: s.info.Recording, Access: viewer.Access, Owner: s.info.UserEmail})
+	if replay := s.scrollback.Bytes(); len(replay) > 0 {
+		client.SendOutput(replay)
+	}
+	s.notifyOwner()
+	s.mu.Unlock()
+
+	s.readInput(client, &viewer)
+
+	s.mu.Lock()
+	delete(s.viewers, client)
+	s.notifyOwner()
+	s.mu.Unlock()
+	client.Close()
+}
+
+// Close hangs up the session's terminal. The process group is sent SIGHUP,
+// and anything still running once the PTY has closed is killed.
+func (s *LiveSession) Close() {
+	if s.cmd.Process != nil {
+		syscall.Kill(-s.cmd.Process.Pid, syscall.SIGHUP)
+	}
+	s.ptmx.Close()
+}
+
+// watchdog ends the session when it has been idle for too long or has run
+// for its maximum duration, warning its clients first
+func (s *LiveSession) watchdog(limits Limits) {
+	ticker := time.NewTicker(watchdogInterval(limits))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			if s.checkLimits(limits, now) {
+				return
+			}
+		}
+	}
+}
+
+// checkLimits warns about or enforces the next cutoff, reporting whether the
+// session was closed
+func (s *LiveSession) checkLimits(limits Limits, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff, reason := s.cutoff(limits)
+	if !now.Before(cutoff) {
+		log.Printf("Terminal session %s of %s: %s", s.info.ID, s.info.UserEmail, reason)
+		s.exitReason = reason
+		go s.Close()
+		return true
+	}
+
+	if now.After(cutoff.Add(-limits.WarnBefore)) && !s.warnedFor.Equal(cutoff) {
+		s.warnedFor = cutoff
+		remaining := cutoff.Sub(now).Round(time.Second)
+		text := fmt.Sprintf("This session will end in %s because of the maximum session length.", remaining)
+		if reason == ExitIdle {
+			text = fmt.Sprintf("This session will be closed in %s unless you type something.", remaining)
+		}
+		s.broadcast(ControlMessage{Type: MessageWarning, Data: text})
+	}
+	return false
+}
+
+// cutoff returns the earliest time the session may run until, and the reason
+// it would end then. s.mu must be held.
+func (s *LiveSession) cutoff(limits Limits) (time.Time, string) {
+	var cutoff time.Time
+	var reason string
+	if limits.IdleTimeout > 0 {
+		cutoff, reason = s.lastInput.Add(limits.IdleTimeout), ExitIdle
+	}
+	if limits.MaxDuration > 0 {
+		end := s.info.StartedAt.Add(limits.MaxDuration)
+		if cutoff.IsZero() || end.Before(cutoff) {
+			cutoff, reason = end, ExitDuration
+		}
+	}
+	return cutoff, reason
+}
+
+// watchdogInterval picks how often limits are checked: often enough to warn
+// and close close to on time, without waking up needlessly for long limits
+func watchdogInterval(limits Limits) time.Duration {
+	interval := 10 * time.Second
+	for _, d := range []time.Duration{limits.IdleTimeout, limits.MaxDuration, limits.WarnBefore} {
+		if d > 0 && d/10 < interval {
+			interval = d / 10
+		}
+	}
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
+
+// touch records input for the idle timeout
+func (s *LiveSession) touch() {
+	s.mu.Lock()
+	s.lastInput = time.Now()
+	s.mu.Unlock()
+}
+
+// broadcast sends a control message to the owner and all viewers. s.mu must
+// be held.
+func (s *LiveSession) broadcast(msg ControlMessage) {
+	if s.client != nil {
+		s.client.SendJSON(msg)
+	}
+	for viewer := range s.viewers {
+		viewer.SendJSON(msg)
+	}
+}
+
+// notify sends a control message to the owner's client, if attached
+func (s *LiveSession) notify(msg ControlMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		s.client.SendJSON(msg)
+	}
+}
+
+// disconnectViewers closes the connections of all viewers
+func (s *LiveSession) disconnectViewers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for viewer := range s.viewers {
+		viewer.SendJSON(ControlMessage{Type: MessageUnshared})
+		viewer.CloseWith(websocket.CloseNormalClosure, "sharing stopped")
+	}
+}
+
+// notifyOwner tells the owner's client who is watching. s.mu must be held.
+func (s *LiveSession) notifyOwner() {
+	if s.client != nil {
+		s.client.SendJSON(s.viewersMessage())
+	}
+}
+
+// viewersMessage lists the current viewers. s.mu must be held.
+func (s *LiveSession) viewersMessage() ControlMessage {
+	msg := ControlMessage{Type: MessageViewers, Viewers: []string{}}
+	for _, viewer := range s.viewers {
+		msg.Viewers = append(msg.Viewers, viewer.Email+" ("+viewer.Access+")")
+	}
+	sort.Strings(msg.Viewers)
+	return msg
+}
+
+// detach drops client if it is still the attached one and starts the grace
+// period timer
+func (s *LiveSession) detach(client *socketClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != client {
+		return
+	}
+	s.client = nil
+	if !s.exited {
+		log.Printf("Terminal session %s detached; keeping it for %s", s.info.ID, s.manager.grace)
+		s.detachTimer = time.AfterFunc(s.manager.grace, func() {
+			log.Printf("Terminal session %s was not reattached; closing it", s.info.ID)
+			s.Close()
+		})
+	}
+}
+
+// pump copies PTY output into the scrollback and to the attached clients
+// until the process ends. When the owner's client falls a full window
+// behind, reading pauses until it catches up, which in turn pauses the
+// program writing the output. Viewers that fall behind are disconnected
+// instead, so they cannot slow the owner down.
+func (s *LiveSession) pump() {
+	buf := make([]byte, 16*1024)
+	for {
+		n, err := s.ptmx.Read(buf)
+		if err != nil {
+			s.exit()
+			return
+		}
+
+		s.mu.Lock()
+		s.scrollback.Write(buf[:n])
+		for _, tap := range s.taps {
+			tap.Output(buf[:n])
+		}
+		owner := s.client
+		if owner != nil {
+			owner.SendOutput(buf[:n])
+		}
+		for viewer := range s.viewers {
+			if !viewer.SendOutput(buf[:n]) {
+				log.Printf("Disconnecting a viewer of terminal session %s that fell behind", s.info.ID)
+				viewer.CloseWith(websocket.CloseTryAgainLater, "viewer fell behind")
+			}
+		}
+		s.mu.Unlock()
+
+		if owner != nil {
+			owner.WaitForRoom()
+		}
+	}
+}
+
+// exit tears the session down once the PTY has closed
+func (s *LiveSession) exit() {
+	s.mu.Lock()
+	s.exited = true
+	if s.detachTimer != nil {
+		s.detachTimer.Stop()
+	}
+	s.mu.Unlock()
+
+	// Kill whatever the shell left running in its session. The session
+	// leader is not reaped until Wait, so its ID cannot have been reused.
+	if s.cmd.Process != nil {
+		killSession(s.cmd.Process.Pid)
+	}
+	s.cmd.Wait()
+	s.ptmx.Close()
+
+	// Tell clients how the process ended, in the exit message and in the
+	// close frame's status code
+	code := exitStatus(s.cmd.ProcessState)
+	s.mu.Lock()
+	s.broadcast(ControlMessage{Type: MessageExit, Data: s.exitReason, ExitCode: &code})
+	closeCode, closeReason := CloseExitBase+code, fmt.Sprintf("exited with status %d", code)
+	if s.client != nil {
+		s.client.CloseWith(closeCode, closeReason)
+	}
+	for viewer := range s.viewers {
+		viewer.CloseWith(closeCode, closeReason)
+	}
+	s.mu.Unlock()
+	if s.cleanup != nil {
+		s.cleanup()
+	}
+	for _, tap := range s.taps {
+		if err := tap.Close(); err != nil {
+			log.Printf("Failed to close tap for terminal session %s: %v", s.info.ID, err)
+		}
+	}
+	s.manager.remove(s.info.ID)
+	close(s.done)
+
+	if s.onExit != nil {
+		s.onExit(s)
+	}
+}
+
+// readInput types binary frames from client into the PTY and applies control
+// messages, until the client disconnects. viewer is nil for the owner.
+func (s *LiveSession) readInput(client *socketClient, viewer *Viewer) {
+	for {
+		msgType, msg, err := client.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		switch msgType {
+		case websocket.BinaryMessage:
+			if viewer != nil && !viewer.CanType() {
+				continue
+			}
+			s.touch()
+			for _, tap := range s.taps {
+				tap.Input(msg)
+			}
+			if _, err := s.ptmx.Write(msg); err != nil {
+				log.Println("PTY write error:", err)
+				return
+			}
+		case websocket.TextMessage:
+			s.handleControlMessage(client, viewer, msg)
+		}
+	}
+}
+
+// handleControlMessage applies a JSON control frame from the terminal client.
+// Only the owner's window size applies; viewers keep whatever size it sets.
+func (s *LiveSession) handleControlMessage(client *socketClient, viewer *Viewer, data []byte) {
+	msg, err := ParseControlMessage(data)
+	if err != nil {
+		log.Printf("Rejected terminal control message: %v", err)
+		client.SendJSON(ControlMessage{Type: MessageError, Data: err.Error()})
+		return
+	}
+
+	switch msg.Type {
+	case MessageResize:
+		if viewer != nil {
+			return
+		}
+		if err := pty.Setsize(s.ptmx, &pty.Winsize{Cols: msg.Cols, Rows: msg.Rows}); err != nil {
+			log.Printf("Failed to resize PTY: %v", err)
+		}
+		for _, tap := range s.taps {
+			tap.Resize(msg.Cols, msg.Rows)
+		}
+	case MessagePing:
+		client.SendJSON(ControlMessage{Type: MessagePong, Data: msg.Data})
+	case MessageSignal:
+		if viewer != nil && !viewer.CanType() {
+			client.SendJSON(ControlMessage{Type: MessageError, Data: "read-only viewers cannot send signals"})
+			return
+		}
+		if err := SignalForeground(s.ptmx, msg.Signal); err != nil {
+			log.Printf("Failed to signal terminal process: %v", err)
+		}
+	}
+}
+
+// killSession kills every process in the session led by sid. pty.Start makes
+// the shell a session leader, and a shell with job control runs each job in a
+// process group of its own, so killing the shell's group alone would leave
+// background jobs running. Only a process that starts a new session of its
+// own escapes.
+func killSession(sid int) {
+	syscall.Kill(-sid, syscall.SIGKILL)
+
+	// Members may fork while they are being killed, so look again until
+	// none are left
+	for pass := 0; pass < 10; pass++ {
+		pids := sessionMembers(sid)
+		if len(pids) == 0 {
+			return
+		}
+		for _, pid := range pids {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	log.Printf("Processes of terminal session %d survived being killed", sid)
+}
+
+// sessionMembers lists the live processes in session sid, other than its
+// leader, from /proc
+func sessionMembers(sid int) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == sid {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// The command name is in parentheses and may contain anything, so
+		// the fields are read from after its closing one: state, ppid,
+		// pgrp, session
+		i := bytes.LastIndexByte(stat, ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(string(stat[i+1:]))
+		if len(fields) < 4 || fields[0] == "Z" {
+			continue
+		}
+		if session, err := strconv.Atoi(fields[3]); err == nil && session == sid {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// exitStatus returns a process's exit status, or 128 plus the signal number
+// when it was killed by a signal, as shells report it
+func exitStatus(state *os.ProcessState) int {
+	if state == nil {
+		return 0
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+// NewSessionID returns a random identifier for a terminal session
+func NewSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("terminal: failed to read random bytes: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
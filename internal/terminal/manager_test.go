@@ -0,0 +1,419 @@
+package terminal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readUntil reads frames until output contains want, returning the control
+// messages seen along the way
+func readUntil(t *testing.T, conn *websocket.Conn, want string) []ControlMessage {
+	t.Helper()
+	var output strings.Builder
+	var controls []ControlMessage
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for !strings.Contains(output.String(), want) {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Read failed waiting for %q (output %q): %v", want, output.String(), err)
+		}
+		if msgType == websocket.TextMessage {
+			var msg ControlMessage
+			json.Unmarshal(data, &msg)
+			controls = append(controls, msg)
+			if msg.Type == MessagePong && want == "pong:"+msg.Data {
+				return controls
+			}
+			continue
+		}
+		output.Write(data)
+	}
+	return controls
+}
+
+// TestManagerDetachAndReattach drives a local /bin/sh session over WebSockets,
+// without any cloud dependencies
+func TestManagerDetachAndReattach(t *testing.T) {
+	manager := NewManager(time.Minute, 4096, Limits{})
+	backend := &LocalShellBackend{Shell: "/bin/sh"}
+	upgrader := websocket.Upgrader{}
+
+	cmd, err := backend.Command(Launch{SessionID: "test"})
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	exited := make(chan struct{})
+	live, err := manager.Start(Session{ID: "test", UserEmail: "a@example.com"}, cmd, StartOptions{
+		OnExit: func(*LiveSession) { close(exited) },
+	})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer live.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		live.Attach(conn, r.URL.Query().Get("resume") == "1")
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	first, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	first.WriteJSON(ControlMessage{Type: MessageResize, Cols: 100, Rows: 30})
+	first.WriteMessage(websocket.BinaryMessage, []byte("stty size; echo first-$((20+22))\n"))
+	controls := readUntil(t, first, "first-42")
+	if len(controls) == 0 || controls[0].Type != MessageSession || controls[0].Session != "test" {
+		t.Errorf("Expected a session message first, got %+v", controls)
+	}
+	first.WriteJSON(ControlMessage{Type: MessagePing, Data: "abc"})
+	readUntil(t, first, "pong:abc")
+	first.Close()
+
+	// The shell must survive the disconnect
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := manager.Get("test"); !ok {
+		t.Fatal("Expected detached session to stay registered")
+	}
+	if info := live.Info(); info.Attached {
+		t.Error("Expected session to report detached")
+	}
+
+	second, _, err := websocket.DefaultDialer.Dial(wsURL+"?resume=1", nil)
+	if err != nil {
+		t.Fatalf("Reattach dial failed: %v", err)
+	}
+	defer second.Close()
+	controls = readUntil(t, second, "30 100")
+	if len(controls) == 0 || !controls[0].Resumed {
+		t.Errorf("Expected resumed session message, got %+v", controls)
+	}
+
+	second.WriteMessage(websocket.BinaryMessage, []byte("exit\n"))
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected session to end after exit")
+	}
+	if _, ok := manager.Get("test"); ok {
+		t.Error("Expected ended session to be unregistered")
+	}
+}
+
+func TestManagerClosesAfterGrace(t *testing.T) {
+	manager := NewManager(50*time.Millisecond, 1024, Limits{})
+	cmd, _ := (&LocalShellBackend{Shell: "/bin/sh"}).Command(Launch{})
+	live, err := manager.Start(Session{ID: "grace"}, cmd, StartOptions{})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		live.Attach(conn, false)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.Close()
+
+	select {
+	case <-live.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected detached session to be closed after the grace period")
+	}
+}
+
+func TestManagerSharing(t *testing.T) {
+	manager := NewManager(time.Minute, 4096, Limits{})
+	cmd, _ := (&LocalShellBackend{Shell: "/bin/sh"}).Command(Launch{})
+	live, err := manager.Start(Session{ID: "shared", UserEmail: "owner@example.com"}, cmd, StartOptions{})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer live.Close()
+
+	if _, err := manager.Share("shared", "admin"); err == nil {
+		t.Error("Expected an invalid access level to be rejected")
+	}
+	observeToken, err := manager.Share("shared", AccessObserve)
+	if err != nil {
+		t.Fatalf("Share failed: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if token := r.URL.Query().Get("share"); token != "" {
+			s, access, ok := manager.Redeem(token)
+			if !ok {
+				return
+			}
+			s.Watch(conn, Viewer{Email: "viewer@example.com", Access: access})
+			return
+		}
+		live.Attach(conn, false)
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	owner, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer owner.Close()
+	owner.WriteMessage(websocket.BinaryMessage, []byte("echo before-$((1+1))\n"))
+	readUntil(t, owner, "before-2")
+
+	viewer, _, err := websocket.DefaultDialer.Dial(wsURL+"?share="+observeToken, nil)
+	if err != nil {
+		t.Fatalf("Viewer dial failed: %v", err)
+	}
+	defer viewer.Close()
+	controls := readUntil(t, viewer, "before-2")
+	if len(controls) == 0 || controls[0].Access != AccessObserve || controls[0].Owner != "owner@example.com" {
+		t.Errorf("Expected an observe session message, got %+v", controls)
+	}
+
+	// Read-only input is dropped; the owner's output reaches the viewer
+	viewer.WriteMessage(websocket.BinaryMessage, []byte("echo viewer-$((3+3))\n"))
+	owner.WriteMessage(websocket.BinaryMessage, []byte("echo owner-$((4+4))\n"))
+	readUntil(t, viewer, "owner-8")
+	if info := live.Info(); len(info.Viewers) != 1 || info.Viewers[0].Email != "viewer@example.com" {
+		t.Errorf("Expected one viewer, got %+v", info.Viewers)
+	}
+
+	controlToken, _ := manager.Share("shared", AccessControl)
+	driver, _, err := websocket.DefaultDialer.Dial(wsURL+"?share="+controlToken, nil)
+	if err != nil {
+		t.Fatalf("Driver dial failed: %v", err)
+	}
+	defer driver.Close()
+	readUntil(t, driver, "owner-8")
+	driver.WriteMessage(websocket.BinaryMessage, []byte("echo driver-$((5+5))\n"))
+	controls = readUntil(t, owner, "driver-10")
+	if len(controls) == 0 || controls[len(controls)-1].Type != MessageViewers || len(controls[len(controls)-1].Viewers) != 2 {
+		t.Errorf("Expected the owner to be told about both viewers, got %+v", controls)
+	}
+
+	manager.Unshare("shared")
+	if _, _, ok := manager.Redeem(observeToken); ok {
+		t.Error("Expected share tokens to be invalid after Unshare")
+	}
+	viewer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := viewer.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
+
+func TestManagerLimits(t *testing.T) {
+	manager := NewManager(time.Minute, 1024, Limits{MaxPerUser: 1, MaxTotal: 2})
+	start := func(id, email string) (*LiveSession, error) {
+		cmd, _ := (&LocalShellBackend{Shell: "/bin/sh"}).Command(Launch{})
+		return manager.Start(Session{ID: id, UserEmail: email}, cmd, StartOptions{})
+	}
+
+	first, err := start("one", "a@example.com")
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer first.Close()
+
+	if err := manager.Admit("a@example.com"); !errors.Is(err, ErrUserSessionLimit) {
+		t.Errorf("Expected ErrUserSessionLimit from Admit, got %v", err)
+	}
+	if _, err := start("two", "a@example.com"); !errors.Is(err, ErrUserSessionLimit) {
+		t.Errorf("Expected ErrUserSessionLimit, got %v", err)
+	}
+
+	second, err := start("three", "b@example.com")
+	if err != nil {
+		t.Fatalf("Start for another user failed: %v", err)
+	}
+	defer second.Close()
+
+	if _, err := start("four", "c@example.com"); !errors.Is(err, ErrSessionLimit) {
+		t.Errorf("Expected ErrSessionLimit, got %v", err)
+	}
+}
+
+func TestManagerIdleTimeout(t *testing.T) {
+	manager := NewManager(time.Minute, 1024, Limits{
+		IdleTimeout: 400 * time.Millisecond,
+		WarnBefore:  300 * time.Millisecond,
+	})
+	cmd, _ := (&LocalShellBackend{Shell: "/bin/sh"}).Command(Launch{})
+	live, err := manager.Start(Session{ID: "idle"}, cmd, StartOptions{})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer live.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		live.Attach(conn, false)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	var warned bool
+	var exit ControlMessage
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for exit.Type != MessageExit {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Read failed before the session ended: %v", err)
+		}
+		if msgType != websocket.TextMessage {
+			continue
+		}
+		var msg ControlMessage
+		json.Unmarshal(data, &msg)
+		switch msg.Type {
+		case MessageWarning:
+			warned = true
+		case MessageExit:
+			exit = msg
+		}
+	}
+
+	if !warned {
+		t.Error("Expected a warning before the idle timeout")
+	}
+	if exit.Data != ExitIdle {
+		t.Errorf("Expected exit reason %q, got %q", ExitIdle, exit.Data)
+	}
+	select {
+	case <-live.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected idle session to end")
+	}
+}
+
+func TestManagerCloseCodeCarriesExitStatus(t *testing.T) {
+	manager := NewManager(time.Minute, 1024, Limits{})
+	cmd, _ := (&LocalShellBackend{Shell: "/bin/sh"}).Command(Launch{})
+	live, err := manager.Start(Session{ID: "status"}, cmd, StartOptions{})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer live.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		live.Attach(conn, false)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteMessage(websocket.BinaryMessage, []byte("exit 3\n"))
+
+	var exit ControlMessage
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, CloseExitBase+3) {
+				t.Errorf("Expected close code %d, got %v", CloseExitBase+3, err)
+			}
+			break
+		}
+		if msgType == websocket.TextMessage {
+			json.Unmarshal(data, &exit)
+		}
+	}
+	if exit.Type != MessageExit || exit.ExitCode == nil || *exit.ExitCode != 3 {
+		t.Errorf("Expected an exit message with status 3, got %+v", exit)
+	}
+}
+
+func TestManagerKillsBackgroundJobs(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "job.pid")
+	manager := NewManager(time.Minute, 1024, Limits{})
+	// With job control the job gets a process group of its own, and nohup
+	// makes it ignore the hangup
+	cmd := exec.Command("/bin/sh", "-c", `set -m; nohup sleep 300 >/dev/null 2>&1 & echo $! > "$1"; wait`, "sh", pidFile)
+	live, err := manager.Start(Session{ID: "jobs"}, cmd, StartOptions{})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	var pid int
+	deadline := time.Now().Add(5 * time.Second)
+	for pid == 0 {
+		if data, err := os.ReadFile(pidFile); err == nil {
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Background job never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pgid, _ := syscall.Getpgid(pid); pgid == cmd.Process.Pid {
+		t.Fatal("Expected the background job in a process group of its own")
+	}
+
+	live.Close()
+	select {
+	case <-live.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected session to end")
+	}
+
+	// The orphaned job may linger as a zombie until it is reaped
+	if stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		if fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:])); fields[0] != "Z" {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Errorf("Expected background job %d to be killed, it is in state %s", pid, fields[0])
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// ErrNoPorts is returned when every port in a pool is in use
+var ErrNoPorts = errors.New("no free editor ports")
+
+// PortPool hands out local ports from a fixed range, one per session, so
+// concurrent sessions never share a forward
+type PortPool struct {
+	min, max int
+
+	mu   sync.Mutex
+	used map[int]bool
+	next int
+}
+
+// NewPortPool creates a pool of the ports from min to max inclusive
+func NewPortPool(min, max int) (*PortPool, error) {
+	if min < 1 || max > 65535 || min > max {
+		return nil, fmt.Errorf("invalid port range %d-%d", min, max)
+	}
+	return &PortPool{min: min, max: max, used: make(map[int]bool), next: min}, nil
+}
+
+// Reserve takes a port that is neither reserved nor already bound by another
+// process. Ports are handed out round-robin so a port released by one
+// session is not immediately reused by the next.
+func (p *PortPool) Reserve() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := 0; i <= p.max-p.min; i++ {
+		port := p.next
+		p.next++
+		if p.next > p.max {
+			p.next = p.min
+		}
+		if p.used[port] || !portFree(port) {
+			continue
+		}
+		p.used[port] = true
+		return port, nil
+	}
+	return 0, ErrNoPorts
+}
+
+// Release returns a port to the pool
+func (p *PortPool) Release(port int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.used, port)
+}
+
+// portFree reports whether nothing is listening on the local port
+func portFree(port int) bool {
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
@@ -0,0 +1,121 @@
+package terminal
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"supreme-broccoli/internal/models"
+)
+
+func TestPortPool(t *testing.T) {
+	// Find two adjacent free ports and occupy the first
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer busy.Close()
+	first := busy.Addr().(*net.TCPAddr).Port
+	if first == 65535 || !portFree(first+1) {
+		t.Skip("no free port next to the busy one")
+	}
+
+	pool, err := NewPortPool(first, first+1)
+	if err != nil {
+		t.Fatalf("NewPortPool failed: %v", err)
+	}
+	port, err := pool.Reserve()
+	if err != nil || port != first+1 {
+		t.Fatalf("Expected port %d, the one not in use, got %d (%v)", first+1, port, err)
+	}
+	if _, err := pool.Reserve(); !errors.Is(err, ErrNoPorts) {
+		t.Errorf("Expected ErrNoPorts, got %v", err)
+	}
+
+	pool.Release(port)
+	if again, err := pool.Reserve(); err != nil || again != port {
+		t.Errorf("Expected released port %d to be reserved again, got %d (%v)", port, again, err)
+	}
+
+	if _, err := NewPortPool(9200, 9100); err == nil {
+		t.Error("Expected an inverted range to be rejected")
+	}
+}
+
+func TestManagerEditorPort(t *testing.T) {
+	manager := NewManager(time.Minute, 1024, Limits{})
+	start := func(id, email string, port int, startedAt time.Time) {
+		cmd, _ := (&LocalShellBackend{Shell: "/bin/sh"}).Command(Launch{})
+		live, err := manager.Start(Session{ID: id, UserEmail: email, EditorPort: port, StartedAt: startedAt}, cmd, StartOptions{})
+		if err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		t.Cleanup(live.Close)
+	}
+
+	now := time.Now()
+	start("old", "a@example.com", 9101, now.Add(-time.Hour))
+	start("new", "a@example.com", 9102, now)
+	start("plain", "a@example.com", 0, now.Add(time.Minute))
+	start("other", "b@example.com", 9103, now)
+
+	if port, ok := manager.EditorPort("a@example.com"); !ok || port != 9102 {
+		t.Errorf("Expected the newest forwarded port 9102, got %d", port)
+	}
+	if port, ok := manager.EditorPort("b@example.com"); !ok || port != 9103 {
+		t.Errorf("Expected port 9103 for the other user, got %d", port)
+	}
+	if _, ok := manager.EditorPort("c@example.com"); ok {
+		t.Error("Expected no editor port for a user without sessions")
+	}
+}
+
+func TestManagerPreviewPort(t *testing.T) {
+	manager := NewManager(time.Minute, 1024, Limits{})
+	start := func(id string, previews map[int]int, startedAt time.Time) {
+		cmd, _ := (&LocalShellBackend{Shell: "/bin/sh"}).Command(Launch{})
+		live, err := manager.Start(Session{ID: id, UserEmail: "a@example.com", PreviewPorts: previews, StartedAt: startedAt}, cmd, StartOptions{})
+		if err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		t.Cleanup(live.Close)
+	}
+
+	now := time.Now()
+	start("old", map[int]int{8000: 9101, 3000: 9102}, now.Add(-time.Hour))
+	start("new", map[int]int{8000: 9103}, now)
+
+	if port, ok := manager.PreviewPort("a@example.com", 8000); !ok || port != 9103 {
+		t.Errorf("Expected the newest forward 9103 for port 8000, got %d", port)
+	}
+	if port, ok := manager.PreviewPort("a@example.com", 3000); !ok || port != 9102 {
+		t.Errorf("Expected the older session's forward 9102 for port 3000, got %d", port)
+	}
+	if _, ok := manager.PreviewPort("a@example.com", 5000); ok {
+		t.Error("Expected no forward for a port no session forwards")
+	}
+}
+
+func TestCloudShellForwards(t *testing.T) {
+	backend := &CloudShellBackend{EditorPort: 8080, PreviewPorts: []int{3000, 8000}}
+	cmd, err := backend.Command(Launch{
+		User:         models.User{Email: "a@example.com", AccessToken: "token"},
+		EditorPort:   9100,
+		PreviewPorts: map[int]int{8000: 9101},
+	})
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+
+	args := strings.Join(cmd.Args, " ")
+	for _, want := range []string{"--ssh-flag=-L 9100:localhost:8080", "--ssh-flag=-L 9101:localhost:8000"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Expected %q in %q", want, args)
+		}
+	}
+	if strings.Contains(args, ":3000") {
+		t.Errorf("Expected no forward for a preview port without a local port: %q", args)
+	}
+}
@@ -0,0 +1,138 @@
+package terminal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// The /ws socket carries raw terminal bytes in binary frames. Text frames hold
+// JSON control messages that steer the session instead of being typed into it.
+const (
+	MessageResize    = "resize"     // client → server: terminal window size changed
+	MessagePing      = "ping"       // client → server: liveness check, answered with pong
+	MessagePong      = "pong"       // server → client: reply to ping, echoing Data
+	MessageSignal    = "signal"     // client → server: deliver Signal to the foreground job
+	MessageError     = "error"      // server → client: a control message was rejected
+	MessageSession   = "session"    // server → client: the session ID to reattach with
+	MessageExit      = "exit"       // server → client: the shell has ended, Data says why if the server ended it; do not reattach
+	MessageTakenOver = "taken_over" // server → client: another window attached; do not reattach
+	MessageViewers   = "viewers"    // server → owner: who is watching a shared session
+	MessageUnshared  = "unshared"   // server → viewer: the owner stopped sharing
+	MessageWarning   = "warning"    // server → client: the session will soon be closed, Data says why
+	MessageTransfer  = "transfer"   // server → owner: progress of a file upload or download
+)
+
+// CloseExitBase is added to the process's exit status to form the status
+// code of the close frame sent when a session ends, in the 4000-4999 range
+// WebSocket reserves for applications. Other closes use standard codes.
+const CloseExitBase = 4000
+
+// Bounds for resize requests; anything outside is treated as a client bug
+const (
+	maxCols = 1000
+	maxRows = 500
+)
+
+// signals lists the signals clients may send, by name
+var signals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// ControlMessage is a JSON control frame exchanged over the terminal socket
+type ControlMessage struct {
+	Type   string `json:"type"`
+	Cols   uint16 `json:"cols,omitempty"`
+	Rows   uint16 `json:"rows,omitempty"`
+	Signal string `json:"signal,omitempty"`
+	Data   string `json:"data,omitempty"`
+
+	// Session, Resumed and Recording accompany MessageSession. Resumed means
+	// buffered output follows and the client should clear its screen first;
+	// Recording means the client must tell the user the session is recorded.
+	Session   string `json:"session,omitempty"`
+	Resumed   bool   `json:"resumed,omitempty"`
+	Recording bool   `json:"recording,omitempty"`
+
+	// Access and Owner accompany MessageSession for viewers of a shared
+	// session; Viewers accompanies MessageViewers.
+	Access  string   `json:"access,omitempty"`
+	Owner   string   `json:"owner,omitempty"`
+	Viewers []string `json:"viewers,omitempty"`
+
+	// ExitCode accompanies MessageExit once the process has been reaped
+	ExitCode *int `json:"exit_code,omitempty"`
+
+	// File, Direction, Bytes, Total and Done accompany MessageTransfer. Total
+	// is zero when the size is not known in advance. Done marks the last
+	// message of a transfer, with Data saying why it failed if it did.
+	File      string `json:"file,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Done      bool   `json:"done,omitempty"`
+}
+
+// ParseControlMessage decodes and validates a control frame from the client
+func ParseControlMessage(data []byte) (ControlMessage, error) {
+	var msg ControlMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, fmt.Errorf("invalid control message: %v", err)
+	}
+
+	switch msg.Type {
+	case MessageResize:
+		if msg.Cols == 0 || msg.Rows == 0 || msg.Cols > maxCols || msg.Rows > maxRows {
+			return msg, fmt.Errorf("invalid terminal size %dx%d", msg.Cols, msg.Rows)
+		}
+	case MessagePing:
+	case MessageSignal:
+		if _, ok := signals[msg.Signal]; !ok {
+			return msg, fmt.Errorf("unsupported signal %q", msg.Signal)
+		}
+	default:
+		return msg, fmt.Errorf("unknown control message type %q", msg.Type)
+	}
+
+	return msg, nil
+}
+
+// interruptChar is the terminal's default interrupt character, ^C
+const interruptChar = 0x03
+
+// SignalForeground delivers the named signal to the job in the foreground
+// of the terminal behind ptmx. Under job control each pipeline the shell runs
+// gets its own process group, and an interactive shell ignores SIGINT, so the
+// shell's own group is the wrong target.
+//
+// SIGINT is sent by typing ^C, which the terminal's line discipline turns
+// into SIGINT for the foreground group. This also reaches remote jobs:
+// backends that run gcloud or ssh put the local terminal in raw mode and
+// forward the byte to the remote one. Other signals go to the foreground
+// process group of the local terminal, which for those backends is the
+// client itself.
+func SignalForeground(ptmx *os.File, name string) error {
+	sig, ok := signals[name]
+	if !ok {
+		return fmt.Errorf("unsupported signal %q", name)
+	}
+	if sig == syscall.SIGINT {
+		if _, err := ptmx.Write([]byte{interruptChar}); err != nil {
+			return fmt.Errorf("failed to type interrupt: %v", err)
+		}
+		return nil
+	}
+
+	pgrp, err := unix.IoctlGetInt(int(ptmx.Fd()), unix.TIOCGPGRP)
+	if err != nil {
+		return fmt.Errorf("failed to find foreground process group: %v", err)
+	}
+	if err := syscall.Kill(-pgrp, sig); err != nil {
+		return fmt.Errorf("failed to send %s to process group %d: %v", name, pgrp, err)
+	}
+	return nil
+}
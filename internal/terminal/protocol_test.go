@@ -0,0 +1,84 @@
+package terminal
+
+import (
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseControlMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"resize", `{"type":"resize","cols":120,"rows":40}`, false},
+		{"ping", `{"type":"ping","data":"42"}`, false},
+		{"sigint", `{"type":"signal","signal":"SIGINT"}`, false},
+		{"sigterm", `{"type":"signal","signal":"SIGTERM"}`, false},
+		{"zero size", `{"type":"resize","cols":0,"rows":40}`, true},
+		{"huge size", `{"type":"resize","cols":5000,"rows":40}`, true},
+		{"sigkill", `{"type":"signal","signal":"SIGKILL"}`, true},
+		{"unknown type", `{"type":"exec"}`, true},
+		{"not json", `ls -la`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseControlMessage([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseControlMessage(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignalForeground(t *testing.T) {
+	for _, name := range []string{"SIGINT", "SIGTERM"} {
+		t.Run(name, func(t *testing.T) {
+			// The shell runs sleep as a separate foreground job that only a
+			// signal to the terminal's foreground group reaches
+			cmd := exec.Command("sh", "-i")
+			ptmx, err := pty.Start(cmd)
+			if err != nil {
+				t.Skipf("cannot start a PTY: %v", err)
+			}
+			defer ptmx.Close()
+			go io.Copy(io.Discard, ptmx)
+			ptmx.Write([]byte("sleep 30\r"))
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				pgrp, err := unix.IoctlGetInt(int(ptmx.Fd()), unix.TIOCGPGRP)
+				if err == nil && pgrp != cmd.Process.Pid {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("sleep never became the foreground job")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if err := SignalForeground(ptmx, name); err != nil {
+				t.Fatalf("SignalForeground failed: %v", err)
+			}
+			ptmx.Write([]byte("exit 7\r"))
+
+			done := make(chan error, 1)
+			go func() { done <- cmd.Wait() }()
+			select {
+			case <-done:
+				if code := cmd.ProcessState.ExitCode(); code != 7 {
+					t.Errorf("Expected the shell to survive and exit 7, got %d", code)
+				}
+			case <-time.After(5 * time.Second):
+				cmd.Process.Kill()
+				t.Fatal("Foreground job was not signalled")
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package terminal
+
+// RingBuffer keeps the most recent output of a terminal session, up to a fixed
+// number of bytes, so it can be replayed to a client that reattaches
+type RingBuffer struct {
+	buf  []byte
+	next int  // position of the next write
+	full bool // buf has wrapped at least once
+}
+
+// NewRingBuffer creates a buffer holding at most size bytes
+func NewRingBuffer(size int) *RingBuffer {
+	return &RingBuffer{buf: make([]byte, size)}
+}
+
+// Write appends p, discarding the oldest bytes once the buffer is full
+func (b *RingBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(b.buf) == 0 {
+		return n, nil
+	}
+	if n >= len(b.buf) {
+		// Only the tail of p fits
+		copy(b.buf, p[n-len(b.buf):])
+		b.next = 0
+		b.full = true
+		return n, nil
+	}
+
+	copied := copy(b.buf[b.next:], p)
+	if copied < n {
+		copy(b.buf, p[copied:])
+		b.full = true
+	}
+	b.next = (b.next + n) % len(b.buf)
+	if b.next == 0 {
+		b.full = true
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the buffered output, oldest first
+func (b *RingBuffer) Bytes() []byte {
+	if !b.full {
+		return append([]byte(nil), b.buf[:b.next]...)
+	}
+	out := make([]byte, 0, len(b.buf))
+	out = append(out, b.buf[b.next:]...)
+	return append(out, b.buf[:b.next]...)
+}
@@ -0,0 +1,32 @@
+package terminal
+
+import "testing"
+
+func TestRingBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		writes []string
+		want   string
+	}{
+		{"empty", 8, nil, ""},
+		{"under capacity", 8, []string{"abc", "de"}, "abcde"},
+		{"exactly full", 4, []string{"ab", "cd"}, "abcd"},
+		{"wraps", 4, []string{"abc", "def"}, "cdef"},
+		{"wraps twice", 4, []string{"abc", "def", "gh"}, "efgh"},
+		{"single large write", 4, []string{"abcdefgh"}, "efgh"},
+		{"large write after wrap", 4, []string{"abc", "123456"}, "3456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewRingBuffer(tt.size)
+			for _, w := range tt.writes {
+				b.Write([]byte(w))
+			}
+			if got := string(b.Bytes()); got != tt.want {
+				t.Errorf("Bytes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
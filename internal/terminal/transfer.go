@@ -0,0 +1,277 @@
+package terminal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTransferTooLarge is returned when a file exceeds the transfer size limit
+var ErrTransferTooLarge = errors.New("file exceeds the transfer size limit")
+
+// Transfer directions, sent with MessageTransfer
+const (
+	TransferUpload   = "upload"
+	TransferDownload = "download"
+)
+
+// progressInterval is how often transfer progress is reported to the client
+const progressInterval = 250 * time.Millisecond
+
+// Transferer is implemented by backends that can copy files in and out of a
+// session's environment. Relative paths are resolved against the directory
+// the session's shell starts in.
+type Transferer interface {
+	// Upload writes the contents of r to path, replacing any existing file
+	Upload(launch Launch, path string, r io.Reader) error
+	// Download copies the file at path to w
+	Download(launch Launch, path string, w io.Writer) error
+}
+
+// Upload implements Transferer
+func (b *CloudShellBackend) Upload(launch Launch, path string, r io.Reader) error {
+	cmd, err := b.remoteCommand(launch, "cat > "+shellQuote(path))
+	if err != nil {
+		return err
+	}
+	return runTransfer(cmd, r, nil)
+}
+
+// Download implements Transferer
+func (b *CloudShellBackend) Download(launch Launch, path string, w io.Writer) error {
+	cmd, err := b.remoteCommand(launch, "cat -- "+shellQuote(path))
+	if err != nil {
+		return err
+	}
+	return runTransfer(cmd, nil, w)
+}
+
+// remoteCommand runs a single command in the user's Cloud Shell over the same
+// authorized gcloud connection the terminal uses
+func (b *CloudShellBackend) remoteCommand(launch Launch, command string) (*exec.Cmd, error) {
+	if launch.User.AccessToken == "" {
+		return nil, fmt.Errorf("no access token for %s", launch.User.Email)
+	}
+
+	cmd := exec.Command("gcloud", "cloud-shell", "ssh",
+		"--authorize-session",
+		"--quiet",
+		"--command="+command,
+	)
+	cmd.Env = childEnv("CLOUDSDK_AUTH_ACCESS_TOKEN=" + launch.User.AccessToken)
+	return cmd, nil
+}
+
+// Upload implements Transferer
+func (b *LocalShellBackend) Upload(launch Launch, path string, r io.Reader) error {
+	f, err := os.Create(b.resolve(path))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Don't leave a truncated file behind
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Download implements Transferer
+func (b *LocalShellBackend) Download(launch Launch, path string, w io.Writer) error {
+	f, err := os.Open(b.resolve(path))
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// resolve makes path relative to the shell's starting directory
+func (b *LocalShellBackend) resolve(path string) string {
+	if filepath.IsAbs(path) || b.Dir == "" {
+		return path
+	}
+	return filepath.Join(b.Dir, path)
+}
+
+// Upload implements Transferer
+func (b *DockerBackend) Upload(launch Launch, path string, r io.Reader) error {
+	cmd := dockerCommand("exec", "-i", ContainerName(launch.SessionID),
+		"sh", "-c", `cat > "$1"`, "sh", path)
+	return runTransfer(cmd, r, nil)
+}
+
+// Download implements Transferer
+func (b *DockerBackend) Download(launch Launch, path string, w io.Writer) error {
+	cmd := dockerCommand("exec", ContainerName(launch.SessionID), "cat", "--", path)
+	return runTransfer(cmd, nil, w)
+}
+
+// Upload implements Transferer
+func (b *SSHBackend) Upload(launch Launch, path string, r io.Reader) error {
+	if b.Host == "" {
+		return fmt.Errorf("no ssh host configured")
+	}
+	cmd := sshCommand(append(b.args(), "cat > "+shellQuote(path))...)
+	return runTransfer(cmd, r, nil)
+}
+
+// Download implements Transferer
+func (b *SSHBackend) Download(launch Launch, path string, w io.Writer) error {
+	if b.Host == "" {
+		return fmt.Errorf("no ssh host configured")
+	}
+	cmd := sshCommand(append(b.args(), "cat -- "+shellQuote(path))...)
+	return runTransfer(cmd, nil, w)
+}
+
+// runTransfer runs cmd with stdin and stdout connected to a transfer,
+// reporting the command's error output if it fails
+func runTransfer(cmd *exec.Cmd, stdin io.Reader, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s failed: %v: %s", cmd.Args[0], err, msg)
+		}
+		return fmt.Errorf("%s failed: %v", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Transfer tracks a file being copied in or out of a session. It enforces
+// the size limit and reports progress to the owner's client as
+// MessageTransfer control messages.
+type Transfer struct {
+	session   *LiveSession
+	file      string
+	direction string
+	total     int64 // expected size, or 0 when unknown
+	limit     int64
+
+	mu       sync.Mutex
+	bytes    int64
+	reported time.Time
+}
+
+// NewTransfer starts tracking a transfer of file. total is the expected size
+// if known, and limit the most bytes that may be copied; zero means no limit.
+func (s *LiveSession) NewTransfer(direction, file string, total, limit int64) *Transfer {
+	t := &Transfer{session: s, file: file, direction: direction, total: total, limit: limit}
+	s.notify(t.message())
+	return t
+}
+
+// Reader counts bytes read from r against the transfer
+func (t *Transfer) Reader(r io.Reader) io.Reader {
+	return &transferReader{t: t, r: r}
+}
+
+// Writer counts bytes written to w against the transfer
+func (t *Transfer) Writer(w io.Writer) io.Writer {
+	return &transferWriter{t: t, w: w}
+}
+
+// Bytes returns the number of bytes copied so far
+func (t *Transfer) Bytes() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.bytes
+}
+
+// Finish reports the end of the transfer, and why it failed if err is set.
+// It returns the error the transfer failed with: ErrTransferTooLarge if the
+// limit was exceeded, since the copy then fails in whatever way the
+// interrupted reader or writer causes, otherwise err.
+func (t *Transfer) Finish(err error) error {
+	t.mu.Lock()
+	msg := t.message()
+	if t.exceeded() {
+		err = ErrTransferTooLarge
+	}
+	t.mu.Unlock()
+
+	msg.Done = true
+	if err != nil {
+		msg.Data = err.Error()
+	}
+	t.session.notify(msg)
+	return err
+}
+
+// add counts n more bytes, failing once the limit is exceeded
+func (t *Transfer) add(n int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bytes += int64(n)
+	if t.exceeded() {
+		return ErrTransferTooLarge
+	}
+	if now := time.Now(); now.Sub(t.reported) >= progressInterval {
+		t.reported = now
+		t.session.notify(t.message())
+	}
+	return nil
+}
+
+// exceeded reports whether more than the limit has been copied. t.mu must be
+// held.
+func (t *Transfer) exceeded() bool {
+	return t.limit > 0 && t.bytes > t.limit
+}
+
+// message describes the transfer's progress. t.mu must be held.
+func (t *Transfer) message() ControlMessage {
+	return ControlMessage{
+		Type:      MessageTransfer,
+		File:      t.file,
+		Direction: t.direction,
+		Bytes:     t.bytes,
+		Total:     t.total,
+	}
+}
+
+type transferReader struct {
+	t *Transfer
+	r io.Reader
+}
+
+func (r *transferReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if limitErr := r.t.add(n); limitErr != nil {
+			return 0, limitErr
+		}
+	}
+	return n, err
+}
+
+type transferWriter struct {
+	t *Transfer
+	w io.Writer
+}
+
+func (w *transferWriter) Write(p []byte) (int, error) {
+	if err := w.t.add(len(p)); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
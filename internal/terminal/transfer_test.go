@@ -0,0 +1,69 @@
+package terminal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalTransferRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	backend := &LocalShellBackend{Shell: "/bin/sh", Dir: dir}
+	manager := NewManager(time.Minute, 1024, Limits{})
+	cmd, _ := backend.Command(Launch{})
+	live, err := manager.Start(Session{ID: "transfer"}, cmd, StartOptions{})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer live.Close()
+
+	upload := live.NewTransfer(TransferUpload, "notes.txt", 11, 1024)
+	err = upload.Finish(backend.Upload(Launch{}, "notes.txt", upload.Reader(strings.NewReader("hello world"))))
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.txt")); string(data) != "hello world" {
+		t.Errorf("Expected the upload in the shell's directory, got %q", data)
+	}
+
+	var out bytes.Buffer
+	download := live.NewTransfer(TransferDownload, "notes.txt", 0, 1024)
+	if err := download.Finish(backend.Download(Launch{}, "notes.txt", download.Writer(&out))); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if out.String() != "hello world" || download.Bytes() != 11 {
+		t.Errorf("Expected 11 bytes downloaded, got %q (%d)", out.String(), download.Bytes())
+	}
+}
+
+func TestTransferLimit(t *testing.T) {
+	dir := t.TempDir()
+	backend := &LocalShellBackend{Dir: dir}
+	live := &LiveSession{}
+
+	upload := live.NewTransfer(TransferUpload, "big.bin", 0, 4)
+	err := upload.Finish(backend.Upload(Launch{}, "big.bin", upload.Reader(strings.NewReader("too large"))))
+	if !errors.Is(err, ErrTransferTooLarge) {
+		t.Errorf("Expected ErrTransferTooLarge, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "big.bin")); !os.IsNotExist(err) {
+		t.Error("Expected the partial upload to be removed")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, name := range []string{"plain.txt", "with space", "it's", "$(rm -rf ~)", "a\"b"} {
+		out, err := exec.Command("/bin/sh", "-c", "printf %s "+shellQuote(name)).Output()
+		if err != nil {
+			t.Fatalf("sh failed for %q: %v", name, err)
+		}
+		if string(out) != name {
+			t.Errorf("Expected %q to survive quoting, got %q", name, out)
+		}
+	}
+}
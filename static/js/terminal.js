@@ -0,0 +1,485 @@
+// Terminal page: xterm.js bridged to the /ws WebSocket
+
+const terminalElement = document.getElementById('terminal');
+const terminalStatus = document.getElementById('terminalStatus');
+const recordingNotice = document.getElementById('terminalRecordingNotice');
+
+// Keep in sync with the previews in settings.js
+const terminalThemes = {
+  dark: { background: '#1e1e1e', foreground: '#d4d4d4', cursor: '#d4d4d4' },
+  light: { background: '#ffffff', foreground: '#333333', cursor: '#333333' },
+  solarized: { background: '#002b36', foreground: '#839496', cursor: '#93a1a1' },
+  monokai: { background: '#272822', foreground: '#f8f8f2', cursor: '#f8f8f0' }
+};
+
+function setTerminalStatus(text) {
+  if (terminalStatus) {
+    terminalStatus.textContent = text;
+  }
+}
+
+// Read the user's saved preferences rendered into the page
+function readTerminalSettings(element) {
+  const fontSize = parseInt(element.dataset.fontSize, 10);
+  return {
+    fontSize: fontSize >= 10 && fontSize <= 24 ? fontSize : 14,
+    theme: terminalThemes[element.dataset.colorScheme] || terminalThemes.dark,
+    cursorStyle: ['block', 'underline', 'bar'].includes(element.dataset.cursorStyle)
+      ? element.dataset.cursorStyle
+      : 'block'
+  };
+}
+
+if (terminalElement && window.Terminal) {
+  const settings = readTerminalSettings(terminalElement);
+  const term = new Terminal({
+    fontSize: settings.fontSize,
+    fontFamily: getComputedStyle(document.documentElement).getPropertyValue('--font-mono'),
+    theme: settings.theme,
+    cursorStyle: settings.cursorStyle,
+    cursorBlink: true
+  });
+
+  const fitAddon = window.FitAddon ? new FitAddon.FitAddon() : null;
+  if (fitAddon) {
+    term.loadAddon(fitAddon);
+  }
+
+  terminalElement.style.backgroundColor = settings.theme.background;
+  term.open(terminalElement);
+  if (fitAddon) {
+    fitAddon.fit();
+    window.addEventListener('resize', function() {
+      fitAddon.fit();
+    });
+  }
+
+  const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+  const courseID = terminalElement.dataset.course || '';
+
+  // Viewers join someone else's session through a share link, or as an admin
+  const shareToken = terminalElement.dataset.share || '';
+  const watchID = terminalElement.dataset.watch || '';
+  const viewing = Boolean(shareToken || watchID);
+  let readOnly = viewing;
+  let currentSessionID = null;
+  let shared = false;
+  const shareButton = document.getElementById('terminalShare');
+  const shareAccess = document.getElementById('terminalShareAccess');
+  const unshareButton = document.getElementById('terminalUnshare');
+  const uploadButton = document.getElementById('terminalUpload');
+  const uploadInput = document.getElementById('terminalUploadInput');
+  const downloadButton = document.getElementById('terminalDownload');
+
+  // The session ID survives page refreshes in this tab so the shell can be
+  // reattached, with its recent output replayed
+  const sessionKey = 'terminalSession:' + courseID;
+  const maxReconnectDelayMs = 10000;
+  let reconnectDelayMs = 1000;
+
+  const encoder = new TextEncoder();
+  const pingIntervalMs = 30000;
+  let pingTimer = null;
+  let socket = null;
+  let sessionEnded = false;
+
+  // Close codes from the server; see CloseExitBase in internal/terminal
+  const closeExitBase = 4000;
+  const closeTryAgainLater = 1013;
+
+  // Every handshake needs a fresh single-use ticket. The page comes with one;
+  // reconnects ask the server for another.
+  let pageTicket = terminalElement.dataset.ticket || '';
+
+  function nextTicket() {
+    if (pageTicket) {
+      const ticket = pageTicket;
+      pageTicket = '';
+      return Promise.resolve(ticket);
+    }
+    return fetch('/terminal/ticket', { method: 'POST' })
+      .then(function(response) {
+        if (!response.ok) {
+          throw new Error('HTTP ' + response.status);
+        }
+        return response.json();
+      })
+      .then(function(data) { return data.ticket; });
+  }
+
+  function socketURL(ticket) {
+    const params = new URLSearchParams();
+    params.set('ticket', ticket);
+    if (shareToken) {
+      params.set('share', shareToken);
+    } else if (watchID) {
+      params.set('watch', watchID);
+      params.set('access', terminalElement.dataset.access || 'observe');
+    } else {
+      if (courseID) {
+        params.set('course', courseID);
+      }
+      const sessionID = sessionStorage.getItem(sessionKey);
+      if (sessionID) {
+        params.set('session', sessionID);
+      }
+    }
+    return protocol + '//' + window.location.host + '/ws?' + params.toString();
+  }
+
+  // Control messages travel as JSON text frames; keystrokes as binary frames
+  function sendControl(message) {
+    if (socket && socket.readyState === WebSocket.OPEN) {
+      socket.send(JSON.stringify(message));
+    }
+  }
+
+  function sendResize() {
+    if (viewing) {
+      // The owner's window decides the terminal size
+      return;
+    }
+    sendControl({ type: 'resize', cols: term.cols, rows: term.rows });
+  }
+
+  function handleControl(text) {
+    let message;
+    try {
+      message = JSON.parse(text);
+    } catch (e) {
+      // Plain text from the server means the session could not start;
+      // retrying would fail the same way
+      term.write(text);
+      sessionEnded = true;
+      if (!viewing) {
+        sessionStorage.removeItem(sessionKey);
+      }
+      return;
+    }
+    if (message.type === 'session') {
+      if (message.access) {
+        readOnly = message.access !== 'control';
+        setTerminalStatus('Watching ' + message.owner + (readOnly ? ' (read-only)' : ' (can type)'));
+      } else {
+        currentSessionID = message.session;
+        sessionStorage.setItem(sessionKey, message.session);
+      }
+      if (message.resumed) {
+        // Buffered output follows; start from a clean screen
+        term.reset();
+      }
+      if (message.recording && recordingNotice) {
+        recordingNotice.hidden = false;
+      }
+    } else if (message.type === 'exit') {
+      sessionEnded = true;
+      if (message.data) {
+        term.write('\r\n\x1b[33m' + message.data + '\x1b[0m\r\n');
+      }
+      if (!viewing) {
+        sessionStorage.removeItem(sessionKey);
+      }
+    } else if (message.type === 'taken_over') {
+      // Another window reattached; reconnecting here would steal it back
+      sessionEnded = true;
+      term.write('\r\n\x1b[33mThis session was opened in another window.\x1b[0m\r\n');
+    } else if (message.type === 'viewers') {
+      const viewers = message.viewers || [];
+      setTerminalStatus(viewers.length ? 'Connected, watched by ' + viewers.join(', ') : 'Connected');
+      if (unshareButton) {
+        unshareButton.hidden = viewers.length === 0 && !shared;
+      }
+    } else if (message.type === 'warning') {
+      term.write('\r\n\x1b[33m' + message.data + '\x1b[0m\r\n');
+    } else if (message.type === 'unshared') {
+      sessionEnded = true;
+      term.write('\r\n\x1b[33mThe owner stopped sharing this session.\x1b[0m\r\n');
+    } else if (message.type === 'pong') {
+      const sentAt = parseInt(message.data, 10);
+      if (sentAt && !viewing) {
+        setTerminalStatus('Connected (' + (Date.now() - sentAt) + ' ms)');
+      }
+    } else if (message.type === 'transfer') {
+      showTransfer(message);
+    } else if (message.type === 'error') {
+      console.warn('Terminal control message rejected:', message.data);
+    }
+  }
+
+  function connect() {
+    nextTicket()
+      .then(function(ticket) {
+        openSocket(socketURL(ticket));
+      })
+      .catch(function(err) {
+        // Signed out, or the server is unreachable; try again later
+        console.warn('Failed to get a terminal ticket:', err);
+        scheduleReconnect();
+      });
+  }
+
+  function scheduleReconnect() {
+    setTerminalStatus('Reconnecting...');
+    setTimeout(connect, reconnectDelayMs);
+    reconnectDelayMs = Math.min(reconnectDelayMs * 2, maxReconnectDelayMs);
+  }
+
+  function openSocket(url) {
+    socket = new WebSocket(url);
+    socket.binaryType = 'arraybuffer';
+
+    socket.addEventListener('open', function() {
+      setTerminalStatus(viewing ? 'Joining shared session...' : 'Connected');
+      reconnectDelayMs = 1000;
+      sendResize();
+      pingTimer = setInterval(function() {
+        sendControl({ type: 'ping', data: String(Date.now()) });
+      }, pingIntervalMs);
+      term.focus();
+    });
+
+    socket.addEventListener('message', function(event) {
+      if (event.data instanceof ArrayBuffer) {
+        term.write(new Uint8Array(event.data));
+      } else {
+        handleControl(event.data);
+      }
+    });
+
+    socket.addEventListener('close', function(event) {
+      clearInterval(pingTimer);
+      if (event.code >= closeExitBase && event.code < closeExitBase + 256) {
+        sessionEnded = true;
+        setTerminalStatus('Exited (status ' + (event.code - closeExitBase) + ')');
+        term.write('\r\n\x1b[33mProcess exited with status ' + (event.code - closeExitBase) + '.\x1b[0m\r\n');
+        return;
+      }
+      if (event.code === closeTryAgainLater) {
+        sessionEnded = true;
+      }
+      if (viewing || sessionEnded || !sessionStorage.getItem(sessionKey)) {
+        setTerminalStatus('Disconnected');
+        term.write('\r\n\x1b[33mConnection closed.\x1b[0m\r\n');
+        return;
+      }
+      // The shell is still running on the server; reattach to it
+      scheduleReconnect();
+    });
+  }
+
+  connect();
+
+  term.onData(function(data) {
+    if (readOnly) {
+      return;
+    }
+    if (socket && socket.readyState === WebSocket.OPEN) {
+      socket.send(encoder.encode(data));
+    }
+  });
+
+  term.onResize(sendResize);
+
+  const interruptButton = document.getElementById('terminalInterrupt');
+  if (interruptButton) {
+    interruptButton.addEventListener('click', function() {
+      sendControl({ type: 'signal', signal: 'SIGINT' });
+      term.focus();
+    });
+  }
+
+  // Sharing: create a link others can open to watch, or type into, this session
+  function postSessionAction(action, params) {
+    return fetch('/terminal/sessions/' + encodeURIComponent(currentSessionID) + '/' + action, {
+      method: 'POST',
+      body: new URLSearchParams(params || {})
+    }).then(function(response) {
+      if (!response.ok) {
+        throw new Error('HTTP ' + response.status);
+      }
+      return response;
+    });
+  }
+
+  if (shareButton) {
+    shareButton.addEventListener('click', function() {
+      if (!currentSessionID) {
+        return;
+      }
+      const access = shareAccess ? shareAccess.value : 'observe';
+      postSessionAction('share', { access: access })
+        .then(function(response) { return response.json(); })
+        .then(function(data) {
+          const link = window.location.origin + data.url;
+          shared = true;
+          unshareButton.hidden = false;
+          term.write('\r\n\x1b[33mShare link (' + (access === 'control' ? 'can type' : 'read-only') + '): ' + link + '\x1b[0m\r\n');
+          if (navigator.clipboard) {
+            navigator.clipboard.writeText(link).catch(function() {});
+          }
+        })
+        .catch(function(err) {
+          console.warn('Failed to share terminal session:', err);
+        });
+    });
+  }
+
+  if (unshareButton) {
+    unshareButton.addEventListener('click', function() {
+      if (!currentSessionID) {
+        return;
+      }
+      postSessionAction('unshare')
+        .then(function() {
+          shared = false;
+          unshareButton.hidden = true;
+          term.write('\r\n\x1b[33mSharing stopped; existing links no longer work.\x1b[0m\r\n');
+        })
+        .catch(function(err) {
+          console.warn('Failed to stop sharing terminal session:', err);
+        });
+    });
+  }
+
+  // File transfer: uploads land in the shell's working directory. The
+  // browser reports progress sending to this server, and the server reports
+  // progress copying to or from the session over the socket.
+  function formatBytes(n) {
+    if (n >= 1048576) {
+      return (n / 1048576).toFixed(1) + ' MB';
+    }
+    if (n >= 1024) {
+      return (n / 1024).toFixed(1) + ' KB';
+    }
+    return n + ' B';
+  }
+
+  function showTransfer(message) {
+    const verb = message.direction === 'upload' ? 'Uploading ' : 'Downloading ';
+    const bytes = message.bytes || 0;
+    if (message.done) {
+      if (message.data) {
+        term.write('\r\n\x1b[31m' + verb + message.file + ' failed: ' + message.data + '\x1b[0m\r\n');
+      } else {
+        term.write('\r\n\x1b[32m' + (message.direction === 'upload' ? 'Uploaded ' : 'Downloaded ') +
+          message.file + ' (' + formatBytes(bytes) + ')\x1b[0m\r\n');
+      }
+      setTerminalStatus('Connected');
+      return;
+    }
+    let progress = formatBytes(bytes);
+    if (message.total) {
+      progress = Math.floor(bytes * 100 / message.total) + '% of ' + formatBytes(message.total);
+    }
+    setTerminalStatus(verb + message.file + ': ' + progress);
+  }
+
+  function uploadFile(file) {
+    if (!currentSessionID) {
+      return;
+    }
+    const xhr = new XMLHttpRequest();
+    const url = '/terminal/sessions/' + encodeURIComponent(currentSessionID) + '/upload?size=' + file.size;
+    xhr.open('POST', url);
+    xhr.upload.addEventListener('progress', function(event) {
+      if (event.lengthComputable) {
+        setTerminalStatus('Sending ' + file.name + ': ' + Math.floor(event.loaded * 100 / event.total) + '%');
+      }
+    });
+    xhr.addEventListener('load', function() {
+      if (xhr.status !== 200) {
+        term.write('\r\n\x1b[31mUpload of ' + file.name + ' failed: ' + xhr.responseText.trim() + '\x1b[0m\r\n');
+        setTerminalStatus('Connected');
+      }
+    });
+    xhr.addEventListener('error', function() {
+      term.write('\r\n\x1b[31mUpload of ' + file.name + ' failed.\x1b[0m\r\n');
+      setTerminalStatus('Connected');
+    });
+    const form = new FormData();
+    form.append('file', file);
+    xhr.send(form);
+  }
+
+  function downloadFile(path) {
+    const url = '/terminal/sessions/' + encodeURIComponent(currentSessionID) + '/download?path=' + encodeURIComponent(path);
+    const name = path.split('/').pop() || 'download';
+    fetch(url)
+      .then(function(response) {
+        if (!response.ok) {
+          return response.text().then(function(text) { throw new Error(text.trim()); });
+        }
+        const total = parseInt(response.headers.get('Content-Length'), 10) || 0;
+        const reader = response.body.getReader();
+        const chunks = [];
+        let received = 0;
+        function pump() {
+          return reader.read().then(function(result) {
+            if (result.done) {
+              return new Blob(chunks);
+            }
+            chunks.push(result.value);
+            received += result.value.length;
+            if (total) {
+              setTerminalStatus('Receiving ' + name + ': ' + Math.floor(received * 100 / total) + '%');
+            }
+            return pump();
+          });
+        }
+        return pump();
+      })
+      .then(function(blob) {
+        const link = document.createElement('a');
+        link.href = URL.createObjectURL(blob);
+        link.download = name;
+        document.body.appendChild(link);
+        link.click();
+        link.remove();
+        setTimeout(function() { URL.revokeObjectURL(link.href); }, 1000);
+        setTerminalStatus('Connected');
+      })
+      .catch(function(err) {
+        term.write('\r\n\x1b[31mDownload of ' + path + ' failed: ' + err.message + '\x1b[0m\r\n');
+        setTerminalStatus('Connected');
+      });
+  }
+
+  if (uploadButton && uploadInput) {
+    uploadButton.addEventListener('click', function() {
+      uploadInput.click();
+    });
+    uploadInput.addEventListener('change', function() {
+      Array.from(uploadInput.files).forEach(uploadFile);
+      uploadInput.value = '';
+      term.focus();
+    });
+  }
+
+  if (downloadButton) {
+    downloadButton.addEventListener('click', function() {
+      if (!currentSessionID) {
+        return;
+      }
+      const path = window.prompt('Path of the file to download (relative to the starting directory):');
+      if (path) {
+        downloadFile(path.trim());
+      }
+      term.focus();
+    });
+  }
+
+  if (!viewing) {
+    terminalElement.addEventListener('dragover', function(event) {
+      event.preventDefault();
+      terminalElement.classList.add('terminal-dropping');
+    });
+    terminalElement.addEventListener('dragleave', function() {
+      terminalElement.classList.remove('terminal-dropping');
+    });
+    terminalElement.addEventListener('drop', function(event) {
+      event.preventDefault();
+      terminalElement.classList.remove('terminal-dropping');
+      Array.from(event.dataTransfer.files).forEach(uploadFile);
+    });
+  }
+}